@@ -0,0 +1,293 @@
+package admin
+
+import (
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// max size of a request body accepted by the admin api
+	maxRequestBodyBytes = 1 << 16
+	// host the api is served on if its address doesn't name one
+	defaultHost = "127.0.0.1"
+	bearerPrefix = "Bearer "
+)
+
+var (
+	InvalidTimestamp = errors.New("Invalid timestamp. Please provide the number of seconds after 1970.")
+	Unauthorized = errors.New("Unauthorized. Please send the admin token as 'Authorization: Bearer <token>'.")
+	InvalidValue = fmt.Errorf("Invalid value. Please provide a value between %d and %d.", node_interface.MinValue, node_interface.MaxValue)
+)
+
+// Server exposes a GossipNode over HTTP/JSON so nodes can run headless and be managed by scripts.
+//
+// Endpoints:
+//
+//	GET    /status          -> node status
+//	GET    /database        -> list of database entries, ?as_of=<unix timestamp> reconstructs the database at that time
+//	GET    /history/{node_id} -> values recorded for a node id, oldest first
+//	PUT    /value           -> {"value": 5} updates the nodes value
+//	GET    /peers           -> list of peer node ids
+//	POST   /peers           -> {"node_id": "127.0.0.1:8080"} adds a peer
+//	DELETE /peers/{node_id} -> removes a peer
+//	GET    /blacklist       -> list of blacklisted node ids
+//
+// Errors are returned as {"error": "<message>"} with a matching status code.
+// With a token set, every request must send it as 'Authorization: Bearer <token>' or is answered with 401 Unauthorized.
+type Server struct {
+	node node_interface.GossipNode
+
+	logger logging.Logger
+
+	// token is empty if requests don't need one
+	token string
+}
+
+func NewServer(node node_interface.GossipNode, logger logging.Logger) *Server {
+	return &Server{
+		node: node,
+		logger: logger,
+	}
+}
+
+type statusResponse struct {
+	NodeID objects.NodeID `json:"node_id"`
+
+	Identity objects.Identity `json:"identity"`
+
+	ListenAddr string `json:"listen_addr"`
+
+	Mode string `json:"mode"`
+
+	NumPeers int `json:"num_peers"`
+
+	NumBlacklisted int `json:"num_blacklisted"`
+
+	DatabaseSize int `json:"database_size"`
+
+	DatabaseHash string `json:"database_hash"`
+
+	StartedAt *time.Time `json:"started_at,omitempty"`
+
+	LastSuccessfulExchange *time.Time `json:"last_successful_exchange,omitempty"`
+}
+
+type historyEntry struct {
+	// Timestamp is the number of seconds after 1970 the value was set at
+	Timestamp int64 `json:"timestamp"`
+
+	Value int64 `json:"value"`
+
+	// Source is the peer the value was received from, left out if unknown
+	Source *objects.NodeID `json:"source,omitempty"`
+
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type valueRequest struct {
+	Value *int64 `json:"value"`
+}
+
+type peerRequest struct {
+	NodeID objects.NodeID `json:"node_id"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// WithToken has [s] require every request to send [token], see [config.AdminToken].
+func (s *Server) WithToken(token string) *Server {
+	s.token = token
+	return s
+}
+
+// Handler returns the http.Handler routing every admin endpoint.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.getStatus)
+	mux.HandleFunc("GET /database", s.getDatabase)
+	mux.HandleFunc("GET /history/{node_id}", s.getHistory)
+	mux.HandleFunc("PUT /value", s.putValue)
+	mux.HandleFunc("GET /peers", s.getPeers)
+	mux.HandleFunc("POST /peers", s.postPeer)
+	mux.HandleFunc("DELETE /peers/{node_id}", s.deletePeer)
+	mux.HandleFunc("GET /blacklist", s.getBlacklist)
+	if s.token == "" {
+		return mux
+	}
+	return s.authenticate(mux)
+}
+
+// authenticate answers requests that don't send [s.token] with 401 Unauthorized instead of passing them to [next]
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, http.StatusUnauthorized, Unauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Serve starts the admin api on [addr] in the background, on loopback only if [addr] doesn't name a host (ex. ':9200').
+// The listener is bound before returning so address errors are reported to the caller.
+func (s *Server) Serve(addr string) (*http.Server, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort(defaultHost, port)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Addr: ln.Addr().String(), Handler: s.Handler()}
+	go server.Serve(ln)
+	return server, nil
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	status := s.node.GetStatus()
+	resp := statusResponse{
+		NodeID: status.NodeID,
+		Identity: status.Identity,
+		ListenAddr: status.ListenAddr,
+		Mode: status.Mode,
+		NumPeers: status.NumPeers,
+		NumBlacklisted: status.NumBlacklisted,
+		DatabaseSize: status.DatabaseSize,
+		DatabaseHash: status.DatabaseHash,
+	}
+	if !status.StartedAt.IsZero() {
+		resp.StartedAt = &status.StartedAt
+	}
+	if !status.LastSuccessfulExchange.IsZero() {
+		resp.LastSuccessfulExchange = &status.LastSuccessfulExchange
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getDatabase(w http.ResponseWriter, r *http.Request) {
+	db := s.node.GetDatabase()
+	if asOfStr := r.URL.Query().Get("as_of"); asOfStr != "" {
+		asOf, err := strconv.ParseInt(asOfStr, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, InvalidTimestamp)
+			return
+		}
+		db = db.AsOf(time.Unix(asOf, 0))
+	}
+	s.writeJSON(w, http.StatusOK, db)
+}
+
+func (s *Server) getHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := objects.DeserializeNodeID(r.PathValue("node_id"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entries := []historyEntry{}
+	for _, entry := range s.node.GetDatabase().GetHistory(id) {
+		historyEntry := historyEntry{
+			Timestamp: entry.Value.GetTime().Unix(),
+			Value: entry.Value.GetValue(),
+			ReceivedAt: entry.ReceivedAt,
+		}
+		if entry.Source != (objects.NodeID{}) {
+			historyEntry.Source = &entry.Source
+		}
+		entries = append(entries, historyEntry)
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) putValue(w http.ResponseWriter, r *http.Request) {
+	var req valueRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Value == nil || *req.Value < node_interface.MinValue || *req.Value > node_interface.MaxValue {
+		s.writeError(w, http.StatusBadRequest, InvalidValue)
+		return
+	}
+	s.node.UpdateValue(*req.Value)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getPeers(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.node.GetPeers())
+}
+
+func (s *Server) postPeer(w http.ResponseWriter, r *http.Request) {
+	var req peerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	peer := req.NodeID
+	if peer == (objects.NodeID{}) {
+		s.writeError(w, http.StatusBadRequest, objects.InvalidNodeID)
+		return
+	}
+	if err := s.node.AddPeer(peer); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, node_interface.PeerBlacklisted) {
+			status = http.StatusConflict
+		}
+		s.writeError(w, status, err)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, peerRequest{NodeID: peer})
+}
+
+func (s *Server) deletePeer(w http.ResponseWriter, r *http.Request) {
+	peer, err := objects.DeserializeNodeID(r.PathValue("node_id"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.node.RemovePeer(peer); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, node_interface.PeerNotFound) {
+			status = http.StatusNotFound
+		}
+		s.writeError(w, status, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getBlacklist(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.node.GetBlacklist())
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn("writing admin response failed", logging.ErrorKey, err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultInterval = 3 * time.Second
+	DefaultDialTimeout = 3 * time.Second
+	DefaultReadTimeout = 3 * time.Second
+	DefaultIdleTimeout = time.Minute
+	DefaultMaxLinesToRead = 256
+	DefaultMaxEntrySize = 1024
+	DefaultMaxDatabaseBytes = 1 << 20
+	DefaultMaxPortsPerIP = 3
+	DefaultSnapshotInterval = 30 * time.Second
+	DefaultCompressionThreshold = 1024
+	MinClusterKeyLength = 16
+	MaxClusterNameLength = 64
+	// fits in a single ethernet frame with the IP and UDP headers
+	DefaultMaxUDPPayload = 1400
+	// the largest payload of a UDP datagram over IPv4
+	MaxDatagramPayload = 65507
+
+	// StrictValidation drops a peer's whole database if any entry is invalid
+	StrictValidation = "strict"
+	// LenientValidation merges the valid entries of a peer's database and skips the invalid ones
+	LenientValidation = "lenient"
+
+	// NoCompression asks peers to send their database uncompressed
+	NoCompression = "none"
+	GzipCompression = "gzip"
+	FlateCompression = "flate"
+)
+
+var (
+	MissingListenAddr = errors.New("Missing listen address. Please provide one in the following format '<ip-address>:<port>'.")
+	InvalidValidation = fmt.Errorf("Invalid validation. Please provide either '%s' or '%s'.", StrictValidation, LenientValidation)
+	InvalidCompression = fmt.Errorf("Invalid compression. Please provide one of '%s', '%s' or '%s'.", NoCompression, GzipCompression, FlateCompression)
+	InvalidMode = fmt.Errorf("Invalid mode. Please provide either '%s' or '%s'.", node_interface.HealthyMode, node_interface.AdverserialMode)
+	InvalidDuration = errors.New("Invalid duration. Please provide a positive duration, ex. '3s'.")
+	InvalidLimit = errors.New("Invalid limit. Please provide a positive integer, or 0 where it disables the feature.")
+	InvalidClusterName = fmt.Errorf("Invalid cluster name. Please provide at most %d letters, digits, '.', '_' or '-'.", MaxClusterNameLength)
+	InvalidClusterKey = fmt.Errorf("Invalid cluster key. Please provide at least %d characters, ex. generated with 'openssl rand -hex 32'.", MinClusterKeyLength)
+	UDPWithTLS = errors.New("UDP can't be used with TLS, datagrams would be sent unencrypted. Please disable 'udp' or use a 'cluster_key' instead.")
+	AdminWithoutToken = errors.New("The admin api of a node with a 'cluster_key' or TLS requires an 'admin_token', anyone reaching it could otherwise change the node's value and peers. Please set 'admin_token'.")
+	InvalidAdminToken = fmt.Errorf("Invalid admin token. Please provide at least %d characters, ex. generated with 'openssl rand -hex 32'.", MinClusterKeyLength)
+	UDPWithoutClusterKey = errors.New("UDP requires a 'cluster_key', anyone could spoof datagrams to have the node send its database to someone else. Please set 'cluster_key' or disable 'udp'.")
+	IncompleteTLS = errors.New("Incomplete TLS config. Please provide 'tls_cert', 'tls_key' and 'tls_ca' together.")
+	MissingAdvertiseAddr = errors.New("Missing advertise address. Peers can't reach a node on an unspecified address, please provide the '<ip-address>:<port>' to advertise.")
+)
+
+// Config holds everything needed to start a gossip node. It is built up from, in increasing order of precedence:
+// Default, a config file (LoadFile), environment variables (LoadEnv) and command line flags.
+type Config struct {
+	// ListenAddr is the '<ip-address>:<port>' the node binds to, ex. '0.0.0.0:8080'
+	ListenAddr string `json:"listen"`
+
+	// AdvertiseAddr is the '<ip-address>:<port>' peers reach the node on and the NodeID it is identified by in every database.
+	// Defaults to [ListenAddr], it must be set if [ListenAddr] is an unspecified address or the node sits behind port mapping.
+	AdvertiseAddr string `json:"advertise"`
+
+	// Cluster is the name of the cluster the node belongs to, it only gossips with nodes of the same cluster.
+	// Nodes without a name, including older nodes, are all in the same unnamed cluster.
+	Cluster string `json:"cluster"`
+
+	// Seeds are the node ids of peers added when the node starts
+	Seeds []string `json:"seeds"`
+
+	// Interval is the time between gossip rounds
+	Interval Duration `json:"interval"`
+
+	// Mode is either node_interface.HealthyMode or node_interface.AdverserialMode
+	Mode string `json:"mode"`
+
+	// Strategy is how an adverserial node answers peers, one of the built-in strategies in node_impls. Ignored by healthy nodes.
+	Strategy string `json:"strategy"`
+
+	// DataDir is the directory the node keeps its state in, created if it doesn't exist.
+	// State isn't persisted if empty.
+	DataDir string `json:"data_dir"`
+
+	// SnapshotInterval is the time between snapshots of the node's state to [DataDir]
+	SnapshotInterval Duration `json:"snapshot_interval"`
+
+	// Daemon runs the node without the interactive repl
+	Daemon bool `json:"daemon"`
+
+	LogLevel string `json:"log_level"`
+
+	LogFormat string `json:"log_format"`
+
+	LogFile string `json:"log_file"`
+
+	// MetricsAddr is the address prometheus metrics are served on, metrics aren't served if empty
+	MetricsAddr string `json:"metrics_addr"`
+
+	// AdminAddr is the address the http/json admin api is served on, the api isn't served if empty.
+	// An address without a host, ex. ':9200', is served on loopback only.
+	AdminAddr string `json:"admin_addr"`
+
+	// AdminToken is the bearer token every admin api request must send, required with a [ClusterKey] or TLS.
+	// Best set with GOSSIP_ADMIN_TOKEN so it doesn't show up in a config file.
+	AdminToken string `json:"admin_token"`
+
+	// DialTimeout bounds how long connecting to a peer can take
+	DialTimeout Duration `json:"dial_timeout"`
+
+	// ReadTimeout bounds how long reading a peer's database can take
+	ReadTimeout Duration `json:"read_timeout"`
+
+	// PersistentConnections keeps the connection to each peer open between gossip rounds instead of dialing it every round.
+	// Peers that don't support it are still dialed every round.
+	PersistentConnections bool `json:"persistent_connections"`
+
+	// IdleTimeout is how long a persistent connection to a peer stays open without an exchange over it
+	IdleTimeout Duration `json:"idle_timeout"`
+
+	// MaxLinesToRead is the max number of database entries read from a peer in one exchange, 0 for no limit
+	MaxLinesToRead int `json:"max_lines_to_read"`
+
+	// Validation is either StrictValidation or LenientValidation
+	Validation string `json:"validation"`
+
+	// Encoding is the encoding the node asks peers to send their database in, objects.BinaryEncoding or objects.TextEncoding.
+	// Peers that don't support it send theirs in the text encoding.
+	Encoding string `json:"encoding"`
+
+	// Compression is the algorithm the node asks peers to compress their database with, NoCompression, GzipCompression or FlateCompression.
+	// Peers that don't support it send theirs uncompressed.
+	Compression string `json:"compression"`
+
+	// CompressionThreshold is the number of bytes a database sent to a peer must reach to be compressed, if the peer asks for it
+	CompressionThreshold int `json:"compression_threshold"`
+
+	// TLSCert is the PEM file of the node's certificate, issued by the cluster CA to the node's NodeID.
+	// Nodes gossip over plaintext TCP if empty.
+	TLSCert string `json:"tls_cert"`
+
+	// TLSKey is the PEM file of the private key of [TLSCert]
+	TLSKey string `json:"tls_key"`
+
+	// TLSCA is the PEM file of the cluster CA, which peers' certificates must be issued by
+	TLSCA string `json:"tls_ca"`
+
+	// ClusterKey is the secret shared by every node in the cluster, which signs every exchange so nodes without it are turned away
+	// before they are sent anything. Exchanges aren't signed if empty.
+	ClusterKey string `json:"cluster_key"`
+
+	// UDP has the node exchange database digests, and databases that fit in [MaxUDPPayload], over UDP before falling back to TCP.
+	// It requires a [ClusterKey].
+	UDP bool `json:"udp"`
+
+	// MaxUDPPayload is the max number of bytes in a UDP datagram sent to a peer
+	MaxUDPPayload int `json:"max_udp_payload"`
+
+	// MaxEntrySize is the max number of bytes in a single database entry read from a peer, 0 for no limit
+	MaxEntrySize int `json:"max_entry_size"`
+
+	// MaxDatabaseBytes is the max number of bytes read from a peer in one exchange, 0 for no limit
+	MaxDatabaseBytes int `json:"max_database_bytes"`
+
+	// MaxPortsPerIP is the max number of NodeIDs with the same IP address kept in the database, 0 for no limit
+	MaxPortsPerIP int `json:"max_ports_per_ip"`
+
+	// HistorySize is the number of past values kept for each NodeID, history isn't kept if 0
+	HistorySize int `json:"history_size"`
+}
+
+// Duration is a time.Duration that is written as a string like '3s' in config files.
+type Duration time.Duration
+
+func Default() *Config {
+	return &Config{
+		Interval: Duration(DefaultInterval),
+		Mode: node_interface.HealthyMode,
+		DialTimeout: Duration(DefaultDialTimeout),
+		ReadTimeout: Duration(DefaultReadTimeout),
+		PersistentConnections: true,
+		IdleTimeout: Duration(DefaultIdleTimeout),
+		MaxLinesToRead: DefaultMaxLinesToRead,
+		Validation: StrictValidation,
+		Encoding: string(objects.BinaryEncoding),
+		Compression: NoCompression,
+		CompressionThreshold: DefaultCompressionThreshold,
+		MaxUDPPayload: DefaultMaxUDPPayload,
+		MaxEntrySize: DefaultMaxEntrySize,
+		MaxDatabaseBytes: DefaultMaxDatabaseBytes,
+		MaxPortsPerIP: DefaultMaxPortsPerIP,
+		SnapshotInterval: Duration(DefaultSnapshotInterval),
+	}
+}
+
+// Validate checks that every field of [c] is usable to start a node.
+func (c *Config) Validate() error {
+	if c.ListenAddr == "" {
+		return MissingListenAddr
+	}
+	listenID, err := c.ListenNodeID()
+	if err != nil {
+		return err
+	}
+	if c.AdvertiseAddr == "" && isUnspecified(listenID) {
+		return MissingAdvertiseAddr
+	}
+	if _, err := c.AdvertiseNodeID(); err != nil {
+		return fmt.Errorf("Invalid 'advertise': %w", err)
+	}
+	if _, err := c.SeedNodeIDs(); err != nil {
+		return err
+	}
+	if c.Mode != node_interface.HealthyMode && c.Mode != node_interface.AdverserialMode {
+		return InvalidMode
+	}
+	if c.Validation != StrictValidation && c.Validation != LenientValidation {
+		return InvalidValidation
+	}
+	if _, err := objects.ParseEncoding(c.Encoding); err != nil {
+		return err
+	}
+	if c.Compression != NoCompression && c.Compression != GzipCompression && c.Compression != FlateCompression {
+		return InvalidCompression
+	}
+	if !isClusterName(c.Cluster) {
+		return InvalidClusterName
+	}
+	if c.ClusterKey != "" && len(c.ClusterKey) < MinClusterKeyLength {
+		return InvalidClusterKey
+	}
+	if c.TLSEnabled() && (c.TLSCert == "" || c.TLSKey == "" || c.TLSCA == "") {
+		return IncompleteTLS
+	}
+	if c.UDP && c.TLSEnabled() {
+		return UDPWithTLS
+	}
+	if c.UDP && c.ClusterKey == "" {
+		return UDPWithoutClusterKey
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < MinClusterKeyLength {
+		return InvalidAdminToken
+	}
+	if c.AdminAddr != "" && c.AdminToken == "" && (c.ClusterKey != "" || c.TLSEnabled()) {
+		return AdminWithoutToken
+	}
+	durations := []struct{
+		name string
+		value Duration
+	}{
+		{"interval", c.Interval},
+		{"dial_timeout", c.DialTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"snapshot_interval", c.SnapshotInterval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			return fmt.Errorf("Invalid '%s': %w", d.name, InvalidDuration)
+		}
+	}
+	// 0 means no limit, or no history for history_size
+	limits := []struct{
+		name string
+		value int
+	}{
+		{"max_lines_to_read", c.MaxLinesToRead},
+		{"max_entry_size", c.MaxEntrySize},
+		{"max_database_bytes", c.MaxDatabaseBytes},
+		{"max_ports_per_ip", c.MaxPortsPerIP},
+		{"history_size", c.HistorySize},
+	}
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return fmt.Errorf("Invalid '%s': %w", limit.name, InvalidLimit)
+		}
+	}
+	// no datagram fits in 0 bytes
+	if c.MaxUDPPayload <= 0 {
+		return fmt.Errorf("Invalid 'max_udp_payload', at least 1: %w", InvalidLimit)
+	}
+	if c.MaxUDPPayload > MaxDatagramPayload {
+		return fmt.Errorf("Invalid 'max_udp_payload', at most %d: %w", MaxDatagramPayload, InvalidLimit)
+	}
+	if c.CompressionThreshold < 0 {
+		return fmt.Errorf("Invalid 'compression_threshold': %w", InvalidLimit)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if format := strings.ToLower(c.LogFormat); format != "" && format != logging.TextFormat && format != logging.JSONFormat {
+		return logging.InvalidLogFormat
+	}
+	return nil
+}
+
+// ListenNodeID returns the address the node binds to.
+func (c *Config) ListenNodeID() (objects.NodeID, error) {
+	return objects.DeserializeNodeID(c.ListenAddr)
+}
+
+// AdvertiseNodeID returns the NodeID the node is identified by, [c.AdvertiseAddr] if set or else [c.ListenAddr].
+func (c *Config) AdvertiseNodeID() (objects.NodeID, error) {
+	if c.AdvertiseAddr == "" {
+		return c.ListenNodeID()
+	}
+	id, err := objects.DeserializeNodeID(c.AdvertiseAddr)
+	if err != nil {
+		return objects.NodeID{}, err
+	}
+	if isUnspecified(id) {
+		return objects.NodeID{}, MissingAdvertiseAddr
+	}
+	return id, nil
+}
+
+// SeedNodeIDs returns the NodeIDs of every seed.
+func (c *Config) SeedNodeIDs() ([]objects.NodeID, error) {
+	seeds := make([]objects.NodeID, 0, len(c.Seeds))
+	for _, seed := range c.Seeds {
+		id, err := objects.DeserializeNodeID(seed)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid seed '%s': %w", seed, err)
+		}
+		seeds = append(seeds, id)
+	}
+	return seeds, nil
+}
+
+// isUnspecified returns true if [id] is on an unspecified address like '0.0.0.0' or '::', which peers can't dial
+func isUnspecified(id objects.NodeID) bool {
+	addr, err := netip.ParseAddr(string(id.IP))
+	return err == nil && addr.IsUnspecified()
+}
+
+// isClusterName returns true if [name] can go in a hello as is
+func isClusterName(name string) bool {
+	if len(name) > MaxClusterNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// WireEncoding returns the encoding the node asks peers to send their database in.
+func (c *Config) WireEncoding() objects.Encoding {
+	enc, err := objects.ParseEncoding(c.Encoding)
+	if err != nil {
+		return objects.TextEncoding
+	}
+	return enc
+}
+
+// TLSEnabled returns true if any TLS file is set, in which case nodes only gossip with peers authenticated by the cluster CA.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" || c.TLSKey != "" || c.TLSCA != ""
+}
+
+// DecoderLimits returns the limits on a database read from a peer.
+func (c *Config) DecoderLimits() objects.DecoderLimits {
+	return objects.DecoderLimits{
+		MaxEntrySize: c.MaxEntrySize,
+		MaxEntries: c.MaxLinesToRead,
+		MaxBytes: int64(c.MaxDatabaseBytes),
+	}
+}
+
+// ParseMode accepts either spelling of adverserial.
+func ParseMode(mode string) string {
+	if strings.ToLower(mode) == "adversarial" {
+		return node_interface.AdverserialMode
+	}
+	return strings.ToLower(mode)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var durationStr string
+	if err := json.Unmarshal(data, &durationStr); err != nil {
+		return InvalidDuration
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return InvalidDuration
+	}
+	*d = Duration(duration)
+	return nil
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"github.com/tedim52/gossip_two/node_interface"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestDefaultWithListenAddrIsValid(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateReturnsMissingListenAddr(t *testing.T) {
+	require.ErrorIs(t, Default().Validate(), MissingListenAddr)
+}
+
+func TestValidateReturnsInvalidLimit(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.MaxPortsPerIP = -1
+	require.ErrorIs(t, cfg.Validate(), InvalidLimit)
+
+	cfg.MaxPortsPerIP = 1
+	cfg.MaxUDPPayload = 0
+	require.ErrorIs(t, cfg.Validate(), InvalidLimit)
+}
+
+func TestValidateAcceptsLimitsOfZero(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.MaxLinesToRead, cfg.MaxEntrySize, cfg.MaxDatabaseBytes, cfg.MaxPortsPerIP = 0, 0, 0, 0
+
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateReturnsInvalidDuration(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.ReadTimeout = 0
+
+	require.ErrorIs(t, cfg.Validate(), InvalidDuration)
+}
+
+func TestValidateReturnsInvalidSeed(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.Seeds = []string{"127.0.0.1"}
+
+	require.Error(t, cfg.Validate())
+}
+
+func TestValidateReturnsMissingAdvertiseAddrForUnspecifiedListenAddr(t *testing.T) {
+	for _, listenAddr := range []string{"0.0.0.0:8080", "[::]:8080"} {
+		cfg := Default()
+		cfg.ListenAddr = listenAddr
+
+		require.ErrorIs(t, cfg.Validate(), MissingAdvertiseAddr)
+	}
+}
+
+func TestAdvertiseNodeIDDefaultsToListenAddr(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+
+	id, err := cfg.AdvertiseNodeID()
+
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", id.Serialize())
+}
+
+func TestAdvertiseNodeIDUsesAdvertiseAddr(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "0.0.0.0:8080"
+	cfg.AdvertiseAddr = "203.0.113.7:18080"
+	require.NoError(t, cfg.Validate())
+
+	id, err := cfg.AdvertiseNodeID()
+
+	require.NoError(t, err)
+	require.Equal(t, "203.0.113.7:18080", id.Serialize())
+}
+
+func TestLoadFileParsesJSON(t *testing.T) {
+	path := writeConfigFile(t, "gossip.json", `{"listen": "127.0.0.1:8080", "seeds": ["127.0.0.1:8081"], "interval": "500ms", "max_ports_per_ip": 5}`)
+	cfg := Default()
+
+	require.NoError(t, cfg.LoadFile(path))
+
+	require.Equal(t, "127.0.0.1:8080", cfg.ListenAddr)
+	require.Equal(t, []string{"127.0.0.1:8081"}, cfg.Seeds)
+	require.Equal(t, Duration(500 * time.Millisecond), cfg.Interval)
+	require.Equal(t, 5, cfg.MaxPortsPerIP)
+	// unset fields keep their defaults
+	require.Equal(t, DefaultMaxLinesToRead, cfg.MaxLinesToRead)
+}
+
+func TestLoadFileParsesKeyValues(t *testing.T) {
+	contents := `# gossip node config
+listen = "127.0.0.1:8080" # trailing comment
+seeds = ["127.0.0.1:8081", '127.0.0.1:8082']
+mode = "adversarial"
+daemon = true
+read_timeout = "5s"
+max_lines_to_read = 10
+`
+	path := writeConfigFile(t, "gossip.toml", contents)
+	cfg := Default()
+
+	require.NoError(t, cfg.LoadFile(path))
+
+	require.Equal(t, "127.0.0.1:8080", cfg.ListenAddr)
+	require.Equal(t, []string{"127.0.0.1:8081", "127.0.0.1:8082"}, cfg.Seeds)
+	require.Equal(t, node_interface.AdverserialMode, cfg.Mode)
+	require.True(t, cfg.Daemon)
+	require.Equal(t, Duration(5 * time.Second), cfg.ReadTimeout)
+	require.Equal(t, 10, cfg.MaxLinesToRead)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestLoadFileReturnsErrorForUnknownKey(t *testing.T) {
+	path := writeConfigFile(t, "gossip.toml", "listen_on = \"127.0.0.1:8080\"\n")
+
+	require.Error(t, Default().LoadFile(path))
+}
+
+func TestLoadFileReturnsInvalidConfigLine(t *testing.T) {
+	path := writeConfigFile(t, "gossip.toml", "listen \"127.0.0.1:8080\"\n")
+
+	require.ErrorIs(t, Default().LoadFile(path), InvalidConfigLine)
+}
+
+func TestLoadFileReturnsInvalidConfigValue(t *testing.T) {
+	path := writeConfigFile(t, "gossip.toml", "listen = 127.0.0.1:8080\n")
+
+	require.ErrorIs(t, Default().LoadFile(path), InvalidConfigValue)
+}
+
+func TestLoadEnvOverridesFields(t *testing.T) {
+	env := map[string]string{
+		"GOSSIP_LISTEN": "127.0.0.1:8080",
+		"GOSSIP_SEEDS": "127.0.0.1:8081, 127.0.0.1:8082",
+		"GOSSIP_INTERVAL": "1s",
+		"GOSSIP_DAEMON": "true",
+		"GOSSIP_MAX_PORTS_PER_IP": "4",
+		"GOSSIP_PERSISTENT_CONNECTIONS": "false",
+	}
+	lookup := func(key string) (string, bool) {
+		val, found := env[key]
+		return val, found
+	}
+	cfg := Default()
+
+	require.NoError(t, cfg.LoadEnv(lookup))
+
+	require.Equal(t, "127.0.0.1:8080", cfg.ListenAddr)
+	require.Equal(t, []string{"127.0.0.1:8081", "127.0.0.1:8082"}, cfg.Seeds)
+	require.Equal(t, Duration(time.Second), cfg.Interval)
+	require.True(t, cfg.Daemon)
+	require.Equal(t, 4, cfg.MaxPortsPerIP)
+	require.False(t, cfg.PersistentConnections)
+}
+
+func TestLoadEnvReturnsErrorForInvalidInt(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		if key == "GOSSIP_MAX_LINES_TO_READ" {
+			return "many", true
+		}
+		return "", false
+	}
+
+	require.Error(t, Default().LoadEnv(lookup))
+}
+
+func TestDecoderLimitsUsesReadLimits(t *testing.T) {
+	cfg := Default()
+
+	limits := cfg.DecoderLimits()
+
+	require.Equal(t, DefaultMaxLinesToRead, limits.MaxEntries)
+	require.Equal(t, DefaultMaxEntrySize, limits.MaxEntrySize)
+	require.Equal(t, int64(DefaultMaxDatabaseBytes), limits.MaxBytes)
+}
+
+func TestValidateReturnsInvalidValidation(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.Validation = "relaxed"
+
+	require.ErrorIs(t, cfg.Validate(), InvalidValidation)
+}
+
+func TestValidateReturnsInvalidEncoding(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.Encoding = "protobuf"
+
+	require.ErrorIs(t, cfg.Validate(), objects.InvalidEncoding)
+	require.Equal(t, objects.BinaryEncoding, Default().WireEncoding())
+}
+
+func TestValidateReturnsInvalidCompression(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.Compression = "zstd"
+	require.ErrorIs(t, cfg.Validate(), InvalidCompression)
+
+	cfg.Compression = GzipCompression
+	cfg.CompressionThreshold = -1
+	require.ErrorIs(t, cfg.Validate(), InvalidLimit)
+}
+
+func TestValidateReturnsIncompleteTLS(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.TLSCert = "node.pem"
+	cfg.TLSKey = "node-key.pem"
+	require.ErrorIs(t, cfg.Validate(), IncompleteTLS)
+
+	cfg.TLSCA = "ca.pem"
+	require.NoError(t, cfg.Validate())
+	require.True(t, cfg.TLSEnabled())
+	require.False(t, Default().TLSEnabled())
+}
+
+func TestValidateReturnsInvalidClusterKey(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.ClusterKey = "hunter2"
+	require.ErrorIs(t, cfg.Validate(), InvalidClusterKey)
+
+	cfg.ClusterKey = "5f3c9a1e8b7d4c2f6a0e9d8c7b6a5f4e"
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateReturnsInvalidClusterName(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.Cluster = "prod cluster"
+	require.ErrorIs(t, cfg.Validate(), InvalidClusterName)
+
+	cfg.Cluster = "prod-eu.1"
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateReturnsUDPWithTLS(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.UDP = true
+	cfg.TLSCert, cfg.TLSKey, cfg.TLSCA = "node.pem", "node-key.pem", "ca.pem"
+	require.ErrorIs(t, cfg.Validate(), UDPWithTLS)
+
+	cfg.TLSCert, cfg.TLSKey, cfg.TLSCA = "", "", ""
+	cfg.ClusterKey = "5f3c9a1e8b7d4c2f6a0e9d8c7b6a5f4e"
+	cfg.MaxUDPPayload = MaxDatagramPayload + 1
+	require.ErrorIs(t, cfg.Validate(), InvalidLimit)
+}
+
+func TestValidateReturnsUDPWithoutClusterKey(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.UDP = true
+
+	require.ErrorIs(t, cfg.Validate(), UDPWithoutClusterKey)
+}
+
+func TestValidateReturnsAdminWithoutToken(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = "127.0.0.1:8080"
+	cfg.AdminAddr = "127.0.0.1:9200"
+	require.NoError(t, cfg.Validate())
+
+	cfg.ClusterKey = "5f3c9a1e8b7d4c2f6a0e9d8c7b6a5f4e"
+	require.ErrorIs(t, cfg.Validate(), AdminWithoutToken)
+
+	cfg.AdminToken = "hunter2"
+	require.ErrorIs(t, cfg.Validate(), InvalidAdminToken)
+
+	cfg.AdminToken = "8d1e4b6f0a2c9e7d5b3a1f8e6c4d2b0a"
+	require.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	envPrefix = "GOSSIP_"
+)
+
+// LoadEnv overwrites the fields of [c] that have an environment variable set, as reported by [lookup] (usually os.LookupEnv).
+// Variables are named 'GOSSIP_' followed by the upper cased config file key, ex. GOSSIP_LISTEN or GOSSIP_MAX_PORTS_PER_IP.
+// Lists are comma separated.
+func (c *Config) LoadEnv(lookup func(string) (string, bool)) error {
+	values := make(map[string]any)
+	configType := reflect.TypeOf(*c)
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		key := field.Tag.Get("json")
+		envVar := envPrefix + strings.ToUpper(key)
+		envVal, found := lookup(envVar)
+		if !found {
+			continue
+		}
+		value, err := parseEnvValue(field.Type, envVal)
+		if err != nil {
+			return fmt.Errorf("Invalid environment variable '%s': %w", envVar, err)
+		}
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return c.apply(values)
+}
+
+func parseEnvValue(fieldType reflect.Type, envVal string) (any, error) {
+	if fieldType == reflect.TypeOf(Duration(0)) {
+		return envVal, nil
+	}
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(envVal)
+	case reflect.Int:
+		return strconv.Atoi(envVal)
+	case reflect.Slice:
+		return SplitList(envVal), nil
+	}
+	return envVal, nil
+}
+
+// SplitList splits a comma separated [list], dropping empty items.
+func SplitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	commentChar = '#'
+	keyValueDelimeter = "="
+	listDelimeter = ','
+)
+
+var (
+	InvalidConfigLine = errors.New("Invalid config line. Please provide lines in the following format 'key = value'.")
+	InvalidConfigValue = errors.New("Invalid config value. Please provide a quoted string, a number, true, false or a list of those in brackets.")
+)
+
+// LoadFile overwrites the fields of [c] set in the file at [path].
+// Files ending in '.json', or starting with '{', are parsed as a JSON object. Anything else is parsed as a flat, TOML-ish list of
+// 'key = value' lines using the same keys as the JSON format:
+//
+//	# comments start with '#'
+//	listen = "127.0.0.1:8080"
+//	seeds = ["127.0.0.1:8081", "127.0.0.1:8082"]
+//	interval = "3s"
+//	daemon = true
+//	max_ports_per_ip = 3
+func (c *Config) LoadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".json" || bytes.HasPrefix(bytes.TrimSpace(contents), []byte("{")) {
+		err = c.applyJSON(contents)
+	} else {
+		var values map[string]any
+		values, err = parseKeyValues(string(contents))
+		if err == nil {
+			err = c.apply(values)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid config file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// apply overwrites the fields of [c] whose JSON key is in [values]
+func (c *Config) apply(values map[string]any) error {
+	contents, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return c.applyJSON(contents)
+}
+
+func (c *Config) applyJSON(contents []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return err
+	}
+	c.Mode = ParseMode(c.Mode)
+	return nil
+}
+
+// parseKeyValues parses the TOML-ish config format into the values of each key
+func parseKeyValues(contents string) (map[string]any, error) {
+	values := make(map[string]any)
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		keyValue := strings.SplitN(line, keyValueDelimeter, 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == "" {
+			return nil, fmt.Errorf("line %d: %w", i + 1, InvalidConfigLine)
+		}
+		value, err := parseValue(strings.TrimSpace(keyValue[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i + 1, err)
+		}
+		values[strings.TrimSpace(keyValue[0])] = value
+	}
+	return values, nil
+}
+
+func parseValue(valueStr string) (any, error) {
+	switch {
+	case strings.HasPrefix(valueStr, "["):
+		if !strings.HasSuffix(valueStr, "]") {
+			return nil, InvalidConfigValue
+		}
+		list := []any{}
+		for _, itemStr := range splitOutsideQuotes(valueStr[1:len(valueStr) - 1], listDelimeter) {
+			itemStr = strings.TrimSpace(itemStr)
+			if itemStr == "" {
+				continue
+			}
+			item, err := parseValue(itemStr)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case strings.HasPrefix(valueStr, "\""):
+		str, err := strconv.Unquote(valueStr)
+		if err != nil {
+			return nil, InvalidConfigValue
+		}
+		return str, nil
+	case strings.HasPrefix(valueStr, "'"):
+		if len(valueStr) < 2 || !strings.HasSuffix(valueStr, "'") {
+			return nil, InvalidConfigValue
+		}
+		return valueStr[1:len(valueStr) - 1], nil
+	case valueStr == "true" || valueStr == "false":
+		return valueStr == "true", nil
+	}
+	if intVal, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+		return intVal, nil
+	}
+	if floatVal, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return floatVal, nil
+	}
+	return nil, InvalidConfigValue
+}
+
+// stripComment removes everything after a '#' that isn't inside a quoted string
+func stripComment(line string) string {
+	parts := splitOutsideQuotes(line, commentChar)
+	return parts[0]
+}
+
+// splitOutsideQuotes splits [s] on every [sep] that isn't inside a quoted string
+func splitOutsideQuotes(s string, sep byte) []string {
+	parts := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == '\\' && quote == '"':
+			i++
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote == 0 && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case quote == 0 && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
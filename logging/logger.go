@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// Field keys shared by every node implementation so that log lines can be filtered consistently.
+	NodeKey = "node"
+	PeerKey = "peer"
+	DurationKey = "duration"
+	ErrorKey = "err"
+
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+var (
+	InvalidLogLevel = errors.New("Invalid log level. Please provide one of 'debug', 'info', 'warn' or 'error'.")
+	InvalidLogFormat = errors.New("Invalid log format. Please provide either 'text' or 'json'.")
+)
+
+// Logger is a leveled, structured logger injected into gossip nodes.
+// [args] are alternating key/value pairs following the log/slog convention, ex.
+//
+//	logger.Warn("gossip exchange failed", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+
+	// With returns a Logger that includes [args] in every line it writes.
+	With(args ...any) Logger
+}
+
+// Options describes where and how a Logger created with New writes.
+type Options struct {
+	// Level is one of 'debug', 'info', 'warn' or 'error'. Defaults to 'info'.
+	Level string
+
+	// Format is either 'text' or 'json'. Defaults to 'text'.
+	Format string
+
+	// File is the path of the file logs are appended to. Defaults to stderr so logs don't interleave
+	// with the REPL on stdout.
+	File string
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// New creates a log/slog backed Logger according to [opts].
+// The returned io.Closer closes the log file, if any, and should be closed on shutdown.
+func New(opts Options) (Logger, io.Closer, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = file
+		closer = file
+	}
+
+	handler, err := newHandler(out, opts.Format, level)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return NewSlogLogger(slog.New(handler)), closer, nil
+}
+
+// NewSlogLogger wraps an existing [logger] as a Logger.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+// Default returns a text Logger writing info level logs and above to stderr.
+func Default() Logger {
+	return NewSlogLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
+}
+
+// Discard returns a Logger that drops everything written to it.
+func Discard() Logger {
+	return NewSlogLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// ParseLevel converts a level name into a slog.Level. An empty [level] is 'info'.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("%w Got '%s'.", InvalidLogLevel, level)
+}
+
+func (l *slogLogger) Debug(msg string, args ...any) {
+	l.logger.Debug(msg, args...)
+}
+
+func (l *slogLogger) Info(msg string, args ...any) {
+	l.logger.Info(msg, args...)
+}
+
+func (l *slogLogger) Warn(msg string, args ...any) {
+	l.logger.Warn(msg, args...)
+}
+
+func (l *slogLogger) Error(msg string, args ...any) {
+	l.logger.Error(msg, args...)
+}
+
+func (l *slogLogger) With(args ...any) Logger {
+	return &slogLogger{logger: l.logger.With(args...)}
+}
+
+func newHandler(out io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "", TextFormat:
+		return slog.NewTextHandler(out, handlerOpts), nil
+	case JSONFormat:
+		return slog.NewJSONHandler(out, handlerOpts), nil
+	}
+	return nil, fmt.Errorf("%w Got '%s'.", InvalidLogFormat, format)
+}
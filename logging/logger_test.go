@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevelReturnsCorrectLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelWarn, level)
+}
+
+func TestParseLevelDefaultsToInfo(t *testing.T) {
+	level, err := ParseLevel("")
+
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelInfo, level)
+}
+
+func TestParseLevelReturnsInvalidLogLevel(t *testing.T) {
+	_, err := ParseLevel("loud")
+
+	require.ErrorIs(t, err, InvalidLogLevel)
+}
+
+func TestNewReturnsInvalidLogFormat(t *testing.T) {
+	_, _, err := New(Options{Format: "xml"})
+
+	require.ErrorIs(t, err, InvalidLogFormat)
+}
+
+func TestNewWritesJSONToFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "gossip.log")
+	logger, closer, err := New(Options{Level: "debug", Format: JSONFormat, File: logFile})
+	require.NoError(t, err)
+
+	logger.With(NodeKey, "127.0.0.1:8080").Warn("gossip exchange failed", PeerKey, "127.0.0.1:3000")
+	require.NoError(t, closer.Close())
+
+	contents, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	line := map[string]any{}
+	require.NoError(t, json.Unmarshal(contents, &line))
+	require.Equal(t, "WARN", line["level"])
+	require.Equal(t, "gossip exchange failed", line["msg"])
+	require.Equal(t, "127.0.0.1:8080", line[NodeKey])
+	require.Equal(t, "127.0.0.1:3000", line[PeerKey])
+}
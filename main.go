@@ -1,71 +1,200 @@
 package main
 
-import (	
+import (
+	"github.com/tedim52/gossip_two/admin"
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/metrics"
 	"github.com/tedim52/gossip_two/node_impls"
 	"github.com/tedim52/gossip_two/node_interface"
 	"github.com/tedim52/gossip_two/node_interface/objects"
 
 	"fmt"
 	"bufio"
-	"os"
+	"context"
 	"errors"
-	"regexp"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 const (
 	promptStr = ">> "
 	addPeerChar = '+'
 	printDBStr = "?"
-	// TODO: this validation logic should go in functions in objects.NodeID, knowledge of correct format/regexes shouldn't be at the main lvl
-	portRegexStr = "^((6553[0-5])|(655[0-2][0-9])|(65[0-4][0-9]{2})|(6[0-4][0-9]{3})|([1-5][0-9]{4})|([0-5]{0,5})|([0-9]{1,4}))$"
-	ipAddressRegexStr = "^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5]).){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])$"
+	// history <ip-address>:<port> prints the recorded values of a node
+	historyCmd = "history"
+	// asof <unix timestamp> prints the database as it was at that time
+	asOfCmd = "asof"
+	// max time to wait for in flight requests when shutting down http servers
+	shutdownTimeout = 5 * time.Second
 )
 
 var (
-	// TODO: this validation logic should go in functions in objects.NodeID, knowledge of correct format/regexes shouldn't be at the main lvl
-	ipAddressRegexPat = regexp.MustCompile(ipAddressRegexStr)
-	portRegexPat = regexp.MustCompile(portRegexStr)
-
-	InvalidInput = errors.New("Invalid input format. Please provide './gossip-two <ip-address> <port> <adverserial mode (true if so)>'.")
+	InvalidInput = errors.New("Invalid input format. Please provide './gossip-two --listen <ip-address>:<port> [flags]' or './gossip-two <ip-address> <port> <adverserial mode (true if so)>'.")
 )
 
 func main() {
 	// process input arguments
-	ip, port, adverserial, err := processInput(os.Args)
+	cfg, err := processInput(os.Args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// logs go to stderr (or a file) so they don't interleave with the repl
+	logger, logCloser, err := logging.New(logging.Options{
+		Level: cfg.LogLevel,
+		Format: cfg.LogFormat,
+		File: cfg.LogFile,
+	})
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	defer logCloser.Close()
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("gossip node failed", logging.ErrorKey, err)
+		fmt.Println(err.Error())
+		logCloser.Close()
+		os.Exit(1)
+	}
+}
 
-	// initialize and start healthy gossip node
+// run starts a node according to [cfg] and blocks until the node is asked to stop, either by a signal or by closing stdin
+func run(cfg *config.Config, logger logging.Logger) error {
+	// initialize and start gossip node
 	var node node_interface.GossipNode
-	if adverserial {
+	var err error
+	if cfg.Mode == node_interface.AdverserialMode {
 		fmt.Println("ADVERSERIAL MODE")
-		node = node_impls.NewAdverserialGossipNode(ip, port)
+		node, err = node_impls.NewAdverserialGossipNode(cfg, logger)
 	} else {
-		node = node_impls.NewHealthyGossipNode(ip, port)	
+		node, err = node_impls.NewHealthyGossipNode(cfg, logger)
+	}
+	if err != nil {
+		return err
+	}
+	// the repl echoes every value that changes, a headless node only logs them
+	if !cfg.Daemon {
+		node.OnUpdate(func(id objects.NodeID, v objects.GossipValue) {
+			fmt.Println(fmt.Sprintf("%s --> %s", id.Serialize(), v.GetValueString()))
+		})
+	}
+	if err := node.BoostrapNode(); err != nil {
+		return err
+	}
+	logger.Info("gossip node started", "listen", cfg.ListenAddr, "advertise", node.GetStatus().NodeID.Serialize(), "mode", cfg.Mode)
+
+	var servers []*http.Server
+	defer func() {
+		shutdown(node, servers, logger)
+	}()
+	if cfg.MetricsAddr != "" {
+		server, err := metrics.Serve(cfg.MetricsAddr, node.GetMetrics())
+		if err != nil {
+			return err
+		}
+		servers = append(servers, server)
+		logger.Info("serving metrics", "addr", cfg.MetricsAddr, "path", metrics.MetricsPath)
+	}
+	if cfg.AdminAddr != "" {
+		server, err := admin.NewServer(node, logger).WithToken(cfg.AdminToken).Serve(cfg.AdminAddr)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, server)
+		logger.Info("serving admin api", "addr", cfg.AdminAddr)
+	}
+
+	seeds, err := cfg.SeedNodeIDs()
+	if err != nil {
+		return err
+	}
+	for _, seed := range seeds {
+		if err := node.AddPeer(seed); err != nil {
+			logger.Warn("adding seed failed", logging.PeerKey, seed.Serialize(), logging.ErrorKey, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// start read-eval print loop, closing stdin stops the node like a signal would
+	if !cfg.Daemon {
+		go func() {
+			gossipRepl(node)
+			stop()
+		}()
 	}
-	node.BoostrapNode()
 
-	// start read-eval print loop
-	gossipRepl(node)
+	<-ctx.Done()
+	logger.Info("shutting down gossip node")
+	return nil
+}
+
+// shutdown stops [node] and [servers], waiting at most [shutdownTimeout] for http requests in flight
+func shutdown(node node_interface.GossipNode, servers []*http.Server, logger logging.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("shutting down http server failed", logging.ErrorKey, err)
+		}
+	}
+	node.Shutdown()
 }
 
+// gossipRepl reads commands from stdin until it is closed
 func gossipRepl(node node_interface.GossipNode){
 	inputReader := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print(promptStr)
 		input, err := inputReader.ReadString('\n')
 		if err != nil {
+			if err == io.EOF {
+				return
+			}
 			fmt.Println(err.Error())
 			continue
 		}
 		input = strings.TrimSpace(input)
+		if len(input) == 0 {
+			continue
+		}
 
 		if (input == printDBStr){
 			fmt.Print(node.GetDatabase().Serialize())
+		} else if cmd, arg, found := strings.Cut(input, " "); found && cmd == historyCmd {
+			id, err := objects.DeserializeNodeID(strings.TrimSpace(arg))
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+			history := node.GetDatabase().GetHistory(id)
+			if len(history) == 0 {
+				fmt.Println("No history recorded. Is history_size set?")
+			}
+			for _, entry := range history {
+				fmt.Println(entry.Serialize())
+			}
+		} else if found && cmd == asOfCmd {
+			timestamp, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+			if err != nil {
+				fmt.Println("Please enter the number of seconds after 1970.")
+				continue
+			}
+			fmt.Print(node.GetDatabase().AsOf(time.Unix(timestamp, 0)).Serialize())
 		} else if (input[0] == addPeerChar && len(input) > 1) {
 			input = input[1:]
 			peerNodeID, err := objects.DeserializeNodeID(input)
@@ -79,9 +208,9 @@ func gossipRepl(node node_interface.GossipNode){
 				continue
 			}
 		} else if intVal, err := strconv.ParseInt(input, 10, 32); err == nil {
-			if !(intVal >= 0 && intVal <= 9) {
-				fmt.Println("Please enter a digit 0-9.")	
-				continue	
+			if !(intVal >= node_interface.MinValue && intVal <= node_interface.MaxValue) {
+				fmt.Println("Please enter a digit 0-9.")
+				continue
 			}
 			node.UpdateValue(intVal)
 		} else {
@@ -90,25 +219,126 @@ func gossipRepl(node node_interface.GossipNode){
 	}
 }
 
-// processes command line input by asserting the following format and corresponding regexes of args:
-// input format: ./... <ip-address> <port> <adverserial mode (true if so)>
-func processInput(args []string) (string, string, bool, error) {
-	if args == nil || len(args) < 4 {
-		return "", "", false, InvalidInput
+// processes command line input in either of the following formats:
+// flags: ./... --listen <ip-address>:<port> [--advertise <ip-address>:<port>] [--seeds <ip>:<port>,...] [--interval 3s] [--mode healthy|adverserial] [--strategy <name>] [--config <file>] [--data-dir <dir>] [--daemon]
+// legacy: ./... <ip-address> <port> <adverserial mode (true if so)>
+// values in the file passed to --config are overridden by GOSSIP_* environment variables, which are overridden by flags set on the command line
+func processInput(args []string) (*config.Config, error) {
+	if args == nil || len(args) < 2 {
+		return nil, InvalidInput
+	}
+	args = args[1:]
+	if len(args) == 3 && !strings.HasPrefix(args[0], "-") {
+		return processLegacyInput(args)
+	}
+
+	cfg := config.Default()
+	flags := flag.NewFlagSet("gossip-two", flag.ContinueOnError)
+	configPath := flags.String("config", "", "path to a JSON or TOML-ish ('key = value' lines) config file")
+	listen := flags.String("listen", "", "'<ip-address>:<port>' to listen on and identify this node by")
+	advertise := flags.String("advertise", "", "'<ip-address>:<port>' peers reach this node on and identify it by, if different from --listen")
+	cluster := flags.String("cluster", "", "name of the cluster this node belongs to, it only gossips with nodes of the same cluster")
+	seeds := flags.String("seeds", "", "comma separated '<ip-address>:<port>' of peers to add on startup")
+	interval := flags.Duration("interval", config.DefaultInterval, "time between gossip rounds")
+	mode := flags.String("mode", node_interface.HealthyMode, "'healthy' or 'adverserial'")
+	strategy := flags.String("strategy", node_impls.DefaultStrategy, fmt.Sprintf("how an adverserial node answers peers, one of '%s'", strings.Join(node_impls.StrategyNames(), "', '")))
+	validation := flags.String("validation", config.StrictValidation, "'strict' drops a peer's database with any invalid entry, 'lenient' skips invalid entries")
+	encoding := flags.String("encoding", string(objects.BinaryEncoding), "'binary' or 'text', the encoding peers are asked to send their database in")
+	compression := flags.String("compression", config.NoCompression, "'none', 'gzip' or 'flate', the algorithm peers are asked to compress their database with")
+	tlsCert := flags.String("tls-cert", "", "PEM file of this node's certificate, issued by the cluster CA to its NodeID")
+	tlsKey := flags.String("tls-key", "", "PEM file of the private key of --tls-cert")
+	tlsCA := flags.String("tls-ca", "", "PEM file of the cluster CA peers' certificates must be issued by")
+	udp := flags.Bool("udp", false, "exchange database digests, and databases small enough, with peers over UDP before falling back to TCP")
+	persistentConnections := flags.Bool("persistent-connections", true, "keep the connection to each peer open between gossip rounds, '--persistent-connections=false' dials peers every round")
+	dataDir := flags.String("data-dir", "", "directory to keep node state in")
+	daemon := flags.Bool("daemon", false, "run without the interactive repl until SIGINT or SIGTERM")
+	logLevel := flags.String("log-level", "", "'debug', 'info', 'warn' or 'error'")
+	logFormat := flags.String("log-format", "", "'text' or 'json'")
+	logFile := flags.String("log-file", "", "file to append logs to instead of stderr")
+	metricsAddr := flags.String("metrics-addr", "", "address to serve prometheus metrics on")
+	adminAddr := flags.String("admin-addr", "", "address to serve the http/json admin api on")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
 	}
-	ipAddressStr := args[1]
-	portStr := args[2]
-	adverserialStr := args[3]
-	adverserial := false
-	// TODO: this validation logic should go in functions in objects.NodeID, knowledge of correct format/regexes shouldn't be at the main lvl
-	if !ipAddressRegexPat.Match([]byte(ipAddressStr)) {
-		return "", "", adverserial, objects.InvalidIPAddress
+	if flags.NArg() != 0 {
+		return nil, InvalidInput
+	}
+	if *configPath != "" {
+		if err := cfg.LoadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	// only flags set on the command line override the config file and environment
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.ListenAddr = *listen
+		case "advertise":
+			cfg.AdvertiseAddr = *advertise
+		case "cluster":
+			cfg.Cluster = *cluster
+		case "seeds":
+			cfg.Seeds = config.SplitList(*seeds)
+		case "interval":
+			cfg.Interval = config.Duration(*interval)
+		case "mode":
+			cfg.Mode = config.ParseMode(*mode)
+		case "strategy":
+			cfg.Strategy = *strategy
+		case "validation":
+			cfg.Validation = *validation
+		case "encoding":
+			cfg.Encoding = *encoding
+		case "compression":
+			cfg.Compression = *compression
+		case "tls-cert":
+			cfg.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.TLSKey = *tlsKey
+		case "tls-ca":
+			cfg.TLSCA = *tlsCA
+		case "udp":
+			cfg.UDP = *udp
+		case "persistent-connections":
+			cfg.PersistentConnections = *persistentConnections
+		case "data-dir":
+			cfg.DataDir = *dataDir
+		case "daemon":
+			cfg.Daemon = *daemon
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		case "log-format":
+			cfg.LogFormat = *logFormat
+		case "log-file":
+			cfg.LogFile = *logFile
+		case "metrics-addr":
+			cfg.MetricsAddr = *metricsAddr
+		case "admin-addr":
+			cfg.AdminAddr = *adminAddr
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// input format: <ip-address> <port> <adverserial mode (true if so)>
+func processLegacyInput(args []string) (*config.Config, error) {
+	cfg := config.Default()
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		return nil, err
 	}
-	if !portRegexPat.Match([]byte(portStr)) {
-		return "", "", adverserial, objects.InvalidPortNumber
+	cfg.ListenAddr = objects.NewNodeID(args[0], args[1]).Serialize()
+	if args[2] == "true" {
+		cfg.Mode = node_interface.AdverserialMode
 	}
-	if adverserialStr == "true" {
-		adverserial = true
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	return ipAddressStr, portStr, adverserial, nil
+	return cfg, nil
 }
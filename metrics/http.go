@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+)
+
+const (
+	MetricsPath = "/metrics"
+	// content type of the Prometheus text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Handler returns an http.Handler serving [r] in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		r.WritePrometheus(w)
+	})
+}
+
+// Serve starts an HTTP server on [addr] exposing [r] on MetricsPath.
+// The listener is bound before returning so address errors are reported to the caller; the server itself runs in the background.
+func Serve(addr string, r *Registry) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, r.Handler())
+	server := &http.Server{Handler: mux}
+	go server.Serve(ln)
+	return server, nil
+}
@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	counterType = "counter"
+	gaugeType = "gauge"
+	histogramType = "histogram"
+)
+
+var (
+	metricNameRegexPat = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+
+	// DefaultLatencyBuckets are histogram upper bounds, in seconds, suited to a gossip exchange over TCP.
+	DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	InvalidMetricName = errors.New("Invalid metric name. Names must match [a-zA-Z_:][a-zA-Z0-9_:]*.")
+	DuplicateMetricName = errors.New("A metric with this name is already registered.")
+)
+
+// collector is implemented by every metric type that can be registered with a Registry.
+type collector interface {
+	name() string
+	help() string
+	metricType() string
+	// writeSamples writes the sample lines of the metric in the Prometheus text exposition format.
+	writeSamples(w io.Writer) error
+}
+
+// Registry holds a set of uniquely named metrics and renders them in the Prometheus text exposition format (version 0.0.4).
+type Registry struct {
+	collectors map[string]collector
+
+	mutex sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// NewCounter registers and returns a monotonically increasing counter.
+// Panics if [name] is invalid or already registered, as that is a programming error.
+func (r *Registry) NewCounter(name string, help string) *Counter {
+	c := &Counter{desc: desc{metricName: name, metricHelp: help}}
+	r.mustRegister(c)
+	return c
+}
+
+// NewGauge registers and returns a gauge that can be set to arbitrary values.
+func (r *Registry) NewGauge(name string, help string) *Gauge {
+	g := &Gauge{desc: desc{metricName: name, metricHelp: help}}
+	r.mustRegister(g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by [f] every time the registry is rendered.
+// [f] must be safe to call concurrently and should not block.
+func (r *Registry) NewGaugeFunc(name string, help string, f func() float64) {
+	r.mustRegister(&gaugeFunc{desc: desc{metricName: name, metricHelp: help}, f: f})
+}
+
+// NewHistogram registers and returns a histogram with the given bucket upper bounds.
+// [buckets] are sorted and a +Inf bucket is always added.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64) *Histogram {
+	bounds := append([]float64{}, buckets...)
+	sort.Float64s(bounds)
+	h := &Histogram{
+		desc: desc{metricName: name, metricHelp: help},
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+	r.mustRegister(h)
+	return h
+}
+
+// WritePrometheus writes every registered metric, sorted by name, to [w].
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mutex.RLock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+	for _, c := range collectors {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name(), escapeHelp(c.help()), c.name(), c.metricType()); err != nil {
+			return err
+		}
+		if err := c.writeSamples(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) mustRegister(c collector) {
+	if !metricNameRegexPat.MatchString(c.name()) {
+		panic(fmt.Sprintf("%s Got '%s'.", InvalidMetricName.Error(), c.name()))
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.collectors[c.name()]; found {
+		panic(fmt.Sprintf("%s Got '%s'.", DuplicateMetricName.Error(), c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+type desc struct {
+	metricName string
+
+	metricHelp string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) help() string {
+	return d.metricHelp
+}
+
+// Counter is a metric that only ever increases.
+type Counter struct {
+	desc
+
+	bits uint64
+}
+
+// Add increases the counter by [v]. Negative values are ignored to keep the counter monotonic.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+func (c *Counter) metricType() string {
+	return counterType
+}
+
+func (c *Counter) writeSamples(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", c.name(), formatFloat(c.Value()))
+	return err
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	desc
+
+	bits uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) metricType() string {
+	return gaugeType
+}
+
+func (g *Gauge) writeSamples(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name(), formatFloat(g.Value()))
+	return err
+}
+
+type gaugeFunc struct {
+	desc
+
+	f func() float64
+}
+
+func (g *gaugeFunc) metricType() string {
+	return gaugeType
+}
+
+func (g *gaugeFunc) writeSamples(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name(), formatFloat(g.f()))
+	return err
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	desc
+
+	bounds []float64
+
+	// counts[i] is the number of observations <= bounds[i] and > bounds[i-1] (non cumulative)
+	counts []uint64
+
+	count uint64
+
+	sum float64
+
+	mutex sync.Mutex
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the total number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.count
+}
+
+func (h *Histogram) metricType() string {
+	return histogramType
+}
+
+func (h *Histogram) writeSamples(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name(), formatFloat(bound), cumulative); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", h.name(), h.count, h.name(), formatFloat(h.sum), h.name(), h.count)
+	return err
+}
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(bits, old, updated) {
+			return
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help)
+}
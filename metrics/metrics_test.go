@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheusCounterAndGauge(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("gossip_rounds_total", "Number of gossip rounds.")
+	gauge := registry.NewGauge("gossip_blacklist_size", "Number of blacklisted peers.")
+	counter.Inc()
+	counter.Add(2)
+	counter.Add(-5)
+	gauge.Set(4)
+
+	expected := "# HELP gossip_blacklist_size Number of blacklisted peers.\n" +
+		"# TYPE gossip_blacklist_size gauge\n" +
+		"gossip_blacklist_size 4\n" +
+		"# HELP gossip_rounds_total Number of gossip rounds.\n" +
+		"# TYPE gossip_rounds_total counter\n" +
+		"gossip_rounds_total 3\n"
+	var out strings.Builder
+	require.NoError(t, registry.WritePrometheus(&out))
+
+	require.Equal(t, expected, out.String())
+}
+
+func TestWritePrometheusHistogramIsCumulative(t *testing.T) {
+	registry := NewRegistry()
+	histogram := registry.NewHistogram("gossip_exchange_duration_seconds", "Exchange duration.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(0.1)
+	histogram.Observe(3)
+
+	expected := "# HELP gossip_exchange_duration_seconds Exchange duration.\n" +
+		"# TYPE gossip_exchange_duration_seconds histogram\n" +
+		"gossip_exchange_duration_seconds_bucket{le=\"0.1\"} 2\n" +
+		"gossip_exchange_duration_seconds_bucket{le=\"1\"} 3\n" +
+		"gossip_exchange_duration_seconds_bucket{le=\"+Inf\"} 4\n" +
+		"gossip_exchange_duration_seconds_sum 3.65\n" +
+		"gossip_exchange_duration_seconds_count 4\n"
+	var out strings.Builder
+	require.NoError(t, registry.WritePrometheus(&out))
+
+	require.Equal(t, expected, out.String())
+	require.Equal(t, uint64(4), histogram.Count())
+}
+
+func TestGaugeFuncIsEvaluatedOnWrite(t *testing.T) {
+	registry := NewRegistry()
+	size := 1
+	registry.NewGaugeFunc("gossip_database_size", "Number of entries.", func() float64 {
+		return float64(size)
+	})
+	size = 7
+
+	var out strings.Builder
+	require.NoError(t, registry.WritePrometheus(&out))
+
+	require.Contains(t, out.String(), "gossip_database_size 7\n")
+}
+
+func TestRegisteringDuplicateNamePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("gossip_rounds_total", "")
+
+	require.Panics(t, func() {
+		registry.NewGauge("gossip_rounds_total", "")
+	})
+}
+
+func TestRegisteringInvalidNamePanics(t *testing.T) {
+	registry := NewRegistry()
+
+	require.Panics(t, func() {
+		registry.NewCounter("gossip-rounds", "")
+	})
+}
+
+func TestHandlerServesTextExpositionFormat(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("gossip_rounds_total", "Number of gossip rounds.").Inc()
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + MetricsPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, contentType, resp.Header.Get("Content-Type"))
+	require.Contains(t, string(body), "gossip_rounds_total 1\n")
+}
@@ -0,0 +1,271 @@
+package node_impls
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// how far a hello's timestamp can be from the responder's clock, nonces are remembered for as long
+	maxHelloAge = 30 * time.Second
+	nonceBytes = 16
+	// the database is sent in chunks of at most this many bytes, each followed by its mac
+	maxSealedChunkBytes = 16 * 1024
+)
+
+// every mac covers what it signs and what kind of message it is, so one kind of message can't be passed off as another
+var (
+	requestMACContext = []byte("gossip request\n")
+	responseMACContext = []byte("gossip response\n")
+	payloadMACContext = []byte("gossip payload\n")
+)
+
+var (
+	UnauthenticatedHello = errors.New("Hello isn't signed with the cluster key.")
+	ExpiredHello = errors.New("Hello is too old or from the future, check the clocks of both nodes.")
+	ReplayedHello = errors.New("Hello was already received once.")
+	UnauthenticatedPayload = errors.New("Database isn't signed with the cluster key.")
+)
+
+// clusterAuth authenticates exchanges between nodes sharing a cluster key with HMAC-SHA256.
+// The puller signs its hello along with a random nonce and a timestamp, and the responder only answers hellos that are signed,
+// recent and not seen before. The responder signs its hello along with the puller's, then the database in chunks chained to it,
+// so neither can be replayed into another exchange.
+type clusterAuth struct {
+	key []byte
+
+	mutex sync.Mutex
+
+	// nonces of the hellos received in the last [maxHelloAge], with when they can be forgotten
+	nonces map[string]time.Time
+}
+
+// newClusterAuth returns the clusterAuth of the cluster [key], nil if nodes don't authenticate exchanges
+func newClusterAuth(key string) *clusterAuth {
+	if key == "" {
+		return nil
+	}
+	return &clusterAuth{
+		key: []byte(key),
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// signRequest signs the hello [h] a puller sends, returning it and the exchange that verifies the answer.
+func (a *clusterAuth) signRequest(h hello) (hello, *exchangeAuth, error) {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return hello{}, nil, err
+	}
+	h.nonce = hex.EncodeToString(nonce)
+	h.timestamp = time.Now().Unix()
+	h = signHello(a.key, h, requestMACContext)
+	return h, &exchangeAuth{key: a.key, request: h}, nil
+}
+
+// verifyRequest checks that a puller's hello [h] is signed with the cluster key, recent and not replayed,
+// returning the exchange that signs the answer.
+func (a *clusterAuth) verifyRequest(h hello, found bool) (*exchangeAuth, error) {
+	if !found || !verifyHello(a.key, h, requestMACContext) {
+		return nil, UnauthenticatedHello
+	}
+	now := time.Now()
+	sent := time.Unix(h.timestamp, 0)
+	if sent.Before(now.Add(-maxHelloAge)) || sent.After(now.Add(maxHelloAge)) {
+		return nil, ExpiredHello
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for nonce, expiry := range a.nonces {
+		if now.After(expiry) {
+			delete(a.nonces, nonce)
+		}
+	}
+	if _, found := a.nonces[h.nonce]; found {
+		return nil, ReplayedHello
+	}
+	// a hello can't be replayed once it is too old, so its nonce can be forgotten then
+	a.nonces[h.nonce] = sent.Add(maxHelloAge)
+	return &exchangeAuth{key: a.key, request: h}, nil
+}
+
+// exchangeAuth signs, or verifies, the answer to one signed hello [request]
+type exchangeAuth struct {
+	key []byte
+
+	request hello
+}
+
+func (e *exchangeAuth) responseContext() []byte {
+	return append(append([]byte{}, responseMACContext...), e.request.mac...)
+}
+
+// sign signs the responder's hello [h]
+func (e *exchangeAuth) sign(h hello) hello {
+	return signHello(e.key, h, e.responseContext())
+}
+
+// verify checks that the responder's hello [h] is signed with the cluster key and answers the request.
+// Older nodes that don't send a hello can't sign one.
+func (e *exchangeAuth) verify(h hello, found bool) error {
+	if !found || !verifyHello(e.key, h, e.responseContext()) {
+		return UnauthenticatedHello
+	}
+	return nil
+}
+
+// seal returns a writer that signs the database sent to [w] after the responder's hello [response]. It must be closed to sign
+// the end of the database, so it can't be cut short.
+func (e *exchangeAuth) seal(w io.Writer, response hello) io.WriteCloser {
+	mac, _ := hex.DecodeString(response.mac)
+	return &sealedWriter{w: w, key: e.key, prev: mac}
+}
+
+// open returns a reader of the database in [r] sent after the responder's hello [response], which returns
+// UnauthenticatedPayload as soon as a chunk isn't signed or the database is cut short.
+func (e *exchangeAuth) open(r io.Reader, response hello) io.Reader {
+	mac, _ := hex.DecodeString(response.mac)
+	return &sealedReader{r: bufio.NewReader(r), key: e.key, prev: mac}
+}
+
+// signHello sets the mac of [h] over its other params and [context]
+func signHello(key []byte, h hello, context []byte) hello {
+	h.mac = ""
+	h.signed = h.line()
+	h.mac = hex.EncodeToString(helloMAC(key, h.signed, context))
+	return h
+}
+
+// verifyHello returns true if the mac of [h], parsed from a peer's hello, covers its other params and [context]
+func verifyHello(key []byte, h hello, context []byte) bool {
+	mac, err := hex.DecodeString(h.mac)
+	if err != nil || h.signed == "" {
+		return false
+	}
+	return hmac.Equal(mac, helloMAC(key, h.signed, context))
+}
+
+func helloMAC(key []byte, signed string, context []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(context)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// chunkMAC signs a chunk of the database, chained to the mac [prev] of the chunk, or hello, before it
+func chunkMAC(key []byte, prev []byte, chunk []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payloadMACContext)
+	mac.Write(prev)
+	mac.Write(binary.AppendUvarint(nil, uint64(len(chunk))))
+	mac.Write(chunk)
+	return mac.Sum(nil)
+}
+
+// sealedWriter writes the database as chunks of '<uvarint length><chunk><mac>', ending with an empty chunk
+type sealedWriter struct {
+	w io.Writer
+
+	key []byte
+
+	prev []byte
+
+	pending []byte
+}
+
+func (s *sealedWriter) Write(b []byte) (int, error) {
+	s.pending = append(s.pending, b...)
+	for len(s.pending) >= maxSealedChunkBytes {
+		if err := s.writeChunk(s.pending[:maxSealedChunkBytes]); err != nil {
+			return 0, err
+		}
+		s.pending = s.pending[maxSealedChunkBytes:]
+	}
+	return len(b), nil
+}
+
+// Close writes what is pending and the empty chunk that ends the database.
+func (s *sealedWriter) Close() error {
+	if len(s.pending) > 0 {
+		if err := s.writeChunk(s.pending); err != nil {
+			return err
+		}
+		s.pending = nil
+	}
+	return s.writeChunk(nil)
+}
+
+func (s *sealedWriter) writeChunk(chunk []byte) error {
+	s.prev = chunkMAC(s.key, s.prev, chunk)
+	sealed := binary.AppendUvarint(nil, uint64(len(chunk)))
+	sealed = append(sealed, chunk...)
+	sealed = append(sealed, s.prev...)
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// sealedReader reads the database written by a sealedWriter, only returning chunks once their mac is verified
+type sealedReader struct {
+	r *bufio.Reader
+
+	key []byte
+
+	prev []byte
+
+	chunk []byte
+
+	done bool
+}
+
+func (s *sealedReader) Read(b []byte) (int, error) {
+	for len(s.chunk) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	read := copy(b, s.chunk)
+	s.chunk = s.chunk[read:]
+	return read, nil
+}
+
+func (s *sealedReader) readChunk() error {
+	chunkLen, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return sealedReadError(err)
+	}
+	if chunkLen > maxSealedChunkBytes {
+		return UnauthenticatedPayload
+	}
+	sealed := make([]byte, int(chunkLen) + sha256.Size)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		return sealedReadError(err)
+	}
+	chunk, mac := sealed[:chunkLen], sealed[chunkLen:]
+	if !hmac.Equal(mac, chunkMAC(s.key, s.prev, chunk)) {
+		return UnauthenticatedPayload
+	}
+	s.prev = mac
+	s.chunk = chunk
+	s.done = chunkLen == 0
+	return nil
+}
+
+// sealedReadError returns UnauthenticatedPayload for a database cut short before its end is signed, which could be cut by anyone
+func sealedReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return UnauthenticatedPayload
+	}
+	return err
+}
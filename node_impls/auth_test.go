@@ -0,0 +1,117 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testClusterKey = "5f3c9a1e8b7d4c2f6a0e9d8c7b6a5f4e"
+
+// clusterKeyConfig returns the config of a node on a free port at 127.0.0.1 sharing [key]
+func clusterKeyConfig(t *testing.T, key string) *config.Config {
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	cfg.ClusterKey = key
+	return cfg
+}
+
+func TestNodesSharingClusterKeyGossip(t *testing.T) {
+	firstCfg := clusterKeyConfig(t, testClusterKey)
+	firstCfg.CompressionThreshold = 0
+	first := startTestNode(t, firstCfg, 4)
+	secondCfg := clusterKeyConfig(t, testClusterKey)
+	secondCfg.Compression = config.GzipCompression
+	second := startTestNode(t, secondCfg, 5)
+
+	require.NoError(t, first.AddPeer(second.nodeID))
+	require.NoError(t, second.AddPeer(first.nodeID))
+
+	require.Equal(t, 2, first.database.Size())
+	require.Equal(t, first.database.Serialize(), second.database.Serialize())
+	require.Equal(t, uint64(1), first.metrics.compressionRatio.Count())
+}
+
+func TestNodesWithDifferentClusterKeysDontGossip(t *testing.T) {
+	member := startTestNode(t, clusterKeyConfig(t, testClusterKey), 4)
+	outsider := startTestNode(t, clusterKeyConfig(t, strings.Repeat("x", config.MinClusterKeyLength)), 5)
+	keyless := startTestNode(t, clusterKeyConfig(t, ""), 6)
+
+	require.ErrorIs(t, outsider.AddPeer(member.nodeID), UnauthenticatedHello)
+	require.ErrorIs(t, member.AddPeer(keyless.nodeID), UnauthenticatedHello)
+	// the member hangs up without sending anything, which reads like an older node with an empty database
+	keyless.AddPeer(member.nodeID)
+
+	require.Equal(t, 1, member.database.Size())
+	require.Equal(t, 1, outsider.database.Size())
+	require.Equal(t, 1, keyless.database.Size())
+	require.Equal(t, float64(3), member.metrics.authenticationFailures.Value())
+}
+
+func TestNodeSendsNothingToUnauthenticatedPuller(t *testing.T) {
+	node := startTestNode(t, clusterKeyConfig(t, testClusterKey), 4)
+
+	require.Empty(t, pullRaw(t, node, ""))
+	require.Empty(t, pullRaw(t, node, "GOSSIP/1 enc=text\n"))
+	require.Empty(t, pullRaw(t, node, "GOSSIP/1 enc=text nonce=00 ts=1664228446 mac=00\n"))
+}
+
+func TestNodeRejectsReplayedAndExpiredHellos(t *testing.T) {
+	node := startTestNode(t, clusterKeyConfig(t, testClusterKey), 4)
+	auth := newClusterAuth(testClusterKey)
+	request, _, err := auth.signRequest(hello{encodings: []objects.Encoding{objects.TextEncoding}})
+	require.NoError(t, err)
+
+	require.Contains(t, pullRaw(t, node, request.String()), node.database.Serialize())
+	require.Empty(t, pullRaw(t, node, request.String()))
+
+	request.nonce = "0123456789abcdef"
+	request.timestamp = time.Now().Add(-time.Hour).Unix()
+	require.Empty(t, pullRaw(t, node, signHello([]byte(testClusterKey), request, requestMACContext).String()))
+
+	// the mac covers every param, so none can be changed
+	tampered, _, err := auth.signRequest(hello{encodings: []objects.Encoding{objects.BinaryEncoding}})
+	require.NoError(t, err)
+	require.Empty(t, pullRaw(t, node, strings.Replace(tampered.String(), "enc=binary", "enc=text", 1)))
+}
+
+func TestSealedDatabaseDetectsTampering(t *testing.T) {
+	auth := newClusterAuth(testClusterKey)
+	request, exchange, err := auth.signRequest(hello{})
+	require.NoError(t, err)
+	responder := &exchangeAuth{key: []byte(testClusterKey), request: request}
+	response := responder.sign(hello{encodings: []objects.Encoding{objects.TextEncoding}})
+	dbStr := strings.Repeat("127.0.0.1:8080,1664228446,4\n", 1000)
+	var sent bytes.Buffer
+	sealer := responder.seal(&sent, response)
+	_, err = io.WriteString(sealer, dbStr)
+	require.NoError(t, err)
+	require.NoError(t, sealer.Close())
+	parsed, found, err := readHello(bufio.NewReader(strings.NewReader(response.String())))
+	require.NoError(t, err)
+	require.NoError(t, exchange.verify(parsed, found))
+
+	received, err := io.ReadAll(exchange.open(bytes.NewReader(sent.Bytes()), parsed))
+	require.NoError(t, err)
+	require.Equal(t, dbStr, string(received))
+
+	tampered := bytes.Clone(sent.Bytes())
+	tampered[maxSealedChunkBytes / 2] ^= 1
+	_, err = io.ReadAll(exchange.open(bytes.NewReader(tampered), parsed))
+	require.ErrorIs(t, err, UnauthenticatedPayload)
+
+	_, err = io.ReadAll(exchange.open(bytes.NewReader(sent.Bytes()[:sent.Len() - 1]), parsed))
+	require.ErrorIs(t, err, UnauthenticatedPayload)
+
+	// a response to another request doesn't verify
+	_, other, err := auth.signRequest(hello{})
+	require.NoError(t, err)
+	require.ErrorIs(t, other.verify(parsed, found), UnauthenticatedHello)
+}
@@ -0,0 +1,168 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	numHonestNodes = 3
+	// honest nodes listen on 127.0.0.10, 127.0.0.11, ... so each has its own IP address, the adverserial node on 127.0.0.100
+	firstHonestIP = 10
+	adverserialIP = "127.0.0.100"
+	byzantineInterval = 50 * time.Millisecond
+	byzantineTimeout = 200 * time.Millisecond
+	convergenceTimeout = 15 * time.Second
+	// rounds the honest nodes keep gossiping with the adverserial node after converging, before checking invariants
+	byzantineRounds = 10
+)
+
+// byzantineConfig returns the config of a test node listening on a free port at [ip]
+func byzantineConfig(t *testing.T, ip string, validation string) *config.Config {
+	ln, err := net.Listen("tcp", ip + ":0")
+	if err != nil {
+		t.Skipf("can't listen on %s, the byzantine tests need the 127.0.0.0/8 loopback range: %v", ip, err)
+	}
+	listenAddr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	cfg := config.Default()
+	cfg.ListenAddr = listenAddr
+	cfg.Interval = config.Duration(byzantineInterval)
+	cfg.DialTimeout = config.Duration(byzantineTimeout)
+	cfg.ReadTimeout = config.Duration(byzantineTimeout)
+	cfg.Validation = validation
+	return cfg
+}
+
+// startByzantineCluster starts [numHonestNodes] healthy nodes validating peers' databases with [validation], each with its own value,
+// and an adverserial node running [strategy], all peered with each other.
+func startByzantineCluster(t *testing.T, strategy string, validation string) ([]*GossipNode, *BadGossipNode) {
+	honest := make([]*GossipNode, numHonestNodes)
+	for i := range honest {
+		node, err := NewHealthyGossipNode(byzantineConfig(t, fmt.Sprintf("127.0.0.%d", firstHonestIP + i), validation), logging.Discard())
+		require.NoError(t, err)
+		require.NoError(t, node.BoostrapNode())
+		t.Cleanup(node.Shutdown)
+		node.UpdateValue(int64(i + 1))
+		honest[i] = node
+	}
+	adverserialCfg := byzantineConfig(t, adverserialIP, config.StrictValidation)
+	adverserialCfg.Mode = "adverserial"
+	adverserialCfg.Strategy = strategy
+	adverserial, err := NewAdverserialGossipNode(adverserialCfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, adverserial.BoostrapNode())
+	t.Cleanup(adverserial.Shutdown)
+
+	for _, node := range honest {
+		for _, peer := range honest {
+			if peer != node {
+				require.NoError(t, node.AddPeer(peer.nodeID))
+			}
+		}
+		// the exchange with the adverserial node is expected to fail for most strategies, it is still added as a peer
+		node.AddPeer(adverserial.nodeID)
+		require.Contains(t, node.GetPeers(), adverserial.nodeID)
+		adverserial.AddPeer(node.nodeID)
+	}
+	return honest, adverserial
+}
+
+// converged returns true if every honest node has every other honest node's own value.
+// Values are compared serialized since a node's own value has a finer timestamp than the copies gossiped to its peers.
+func converged(honest []*GossipNode) bool {
+	for _, node := range honest {
+		ownValue, _ := node.database.GetGossipValue(node.nodeID)
+		for _, peer := range honest {
+			peerValue, found := peer.database.GetGossipValue(node.nodeID)
+			if !found || peerValue.Serialize() != ownValue.Serialize() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// requireHonestInvariants checks that [node] kept the database invariants whatever the adverserial node sent it
+func requireHonestInvariants(t *testing.T, node *GossipNode, ownValue objects.GossipValue) {
+	now := time.Now()
+	portsPerIP := map[objects.IPAddress]int{}
+	for _, id := range node.database.GetNodeIDs() {
+		gossipVal, _ := node.database.GetGossipValue(id)
+		require.False(t, gossipVal.GetTime().After(now), "%s has an entry from the future for %s", node.nodeID.Serialize(), id.Serialize())
+		portsPerIP[id.IP]++
+	}
+	for ip, numPorts := range portsPerIP {
+		require.LessOrEqual(t, numPorts, node.config.MaxPortsPerIP, "%s has too many ports for %s", node.nodeID.Serialize(), ip)
+	}
+	selfValue, found := node.database.GetGossipValue(node.nodeID)
+	require.True(t, found)
+	require.Equal(t, ownValue.Serialize(), selfValue.Serialize(), "%s has a forged entry for itself: %s", node.nodeID.Serialize(), selfValue.Serialize())
+}
+
+// byzantineTestCases returns every pair of strategy and validation
+func byzantineTestCases() [][2]string {
+	testCases := [][2]string{}
+	for _, strategy := range StrategyNames() {
+		for _, validation := range []string{config.StrictValidation, config.LenientValidation} {
+			testCases = append(testCases, [2]string{strategy, validation})
+		}
+	}
+	return testCases
+}
+
+func TestHonestNodesStaySafeAgainstEveryStrategy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a cluster of nodes for every strategy")
+	}
+	for _, testCase := range byzantineTestCases() {
+		strategy, validation := testCase[0], testCase[1]
+		t.Run(strategy + "/" + validation, func(t *testing.T) {
+			honest, _ := startByzantineCluster(t, strategy, validation)
+			ownValues := make([]objects.GossipValue, len(honest))
+			for i, node := range honest {
+				ownValues[i], _ = node.database.GetGossipValue(node.nodeID)
+			}
+
+			require.Eventually(t, func() bool {
+				return converged(honest)
+			}, convergenceTimeout, byzantineInterval, "honest nodes didn't converge")
+			time.Sleep(byzantineRounds * byzantineInterval)
+
+			require.True(t, converged(honest), "honest nodes diverged after converging")
+			for i, node := range honest {
+				requireHonestInvariants(t, node, ownValues[i])
+			}
+		})
+	}
+}
+
+func TestHonestNodesKeepIdentitiesOfNodesImpersonatedByPeer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a cluster of nodes")
+	}
+	honest, _ := startByzantineCluster(t, ImpersonateStrategy, config.StrictValidation)
+
+	require.Eventually(t, func() bool {
+		return converged(honest)
+	}, convergenceTimeout, byzantineInterval, "honest nodes didn't converge")
+	time.Sleep(byzantineRounds * byzantineInterval)
+
+	// the adverserial node claims every other honest node moved to a random NodeID
+	for _, node := range honest {
+		for _, peer := range honest {
+			nodeID, found := node.database.GetNodeIDForIdentity(peer.identity)
+			require.True(t, found)
+			require.Equal(t, peer.nodeID, nodeID, "%s moved %s", node.nodeID.Serialize(), peer.nodeID.Serialize())
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+)
+
+// isCompressionAlgorithm returns true if [algorithm] is one this node can compress and decompress with
+func isCompressionAlgorithm(algorithm string) bool {
+	return algorithm == config.GzipCompression || algorithm == config.FlateCompression
+}
+
+// offeredCompressions returns the algorithms a puller preferring [preferred] offers, none if it doesn't want compression
+func offeredCompressions(preferred string) []string {
+	if !isCompressionAlgorithm(preferred) {
+		return nil
+	}
+	return []string{preferred}
+}
+
+func newCompressor(w io.Writer, algorithm string) io.WriteCloser {
+	if algorithm == config.FlateCompression {
+		// only fails for invalid levels
+		compressor, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return compressor
+	}
+	return gzip.NewWriter(w)
+}
+
+// decompress returns a reader of [r] decompressed with [algorithm], or [r] itself if [algorithm] is empty
+func decompress(r io.Reader, algorithm string) (io.Reader, error) {
+	switch algorithm {
+	case config.GzipCompression:
+		return gzip.NewReader(r)
+	case config.FlateCompression:
+		return flate.NewReader(r), nil
+	}
+	return r, nil
+}
+
+// payloadWriter sends the responder's hello, then the database written to it.
+// If the puller can decompress [algorithm], the database is buffered until it reaches [threshold] bytes: databases that do
+// are compressed and announced in the hello, smaller ones are sent as is when the payloadWriter is closed.
+type payloadWriter struct {
+	w io.Writer
+
+	// hello is nil for older pullers, which don't expect one
+	hello *hello
+
+	// auth signs the hello and database if nodes share a cluster key, nil otherwise
+	auth *exchangeAuth
+
+	algorithm string
+
+	threshold int
+
+	metrics *nodeMetrics
+
+	pending []byte
+
+	started bool
+
+	// out is [w], or a compressor writing to it, once the hello is sent
+	out io.Writer
+
+	compressor io.WriteCloser
+
+	sealer io.WriteCloser
+
+	payloadBytes int
+
+	compressedBytes int
+}
+
+func newPayloadWriter(w io.Writer, h *hello, auth *exchangeAuth, algorithm string, threshold int, metrics *nodeMetrics) (*payloadWriter, error) {
+	p := &payloadWriter{
+		w: w,
+		hello: h,
+		auth: auth,
+		algorithm: algorithm,
+		threshold: threshold,
+		metrics: metrics,
+	}
+	if algorithm == "" {
+		// nothing to decide, don't hold the database back
+		return p, p.start(false)
+	}
+	return p, nil
+}
+
+func (p *payloadWriter) Write(b []byte) (int, error) {
+	if p.started {
+		p.payloadBytes += len(b)
+		return p.out.Write(b)
+	}
+	p.pending = append(p.pending, b...)
+	if len(p.pending) >= p.threshold {
+		if err := p.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Close sends a database smaller than the threshold as is, or finishes compressing a larger one, then signs the end of the database
+// if it is signed.
+func (p *payloadWriter) Close() error {
+	if !p.started {
+		if err := p.start(false); err != nil {
+			return err
+		}
+	}
+	if p.compressor != nil {
+		if err := p.compressor.Close(); err != nil {
+			return err
+		}
+		p.metrics.compressedPayloadBytes.Add(float64(p.payloadBytes))
+		p.metrics.compressedBytes.Add(float64(p.compressedBytes))
+		if p.payloadBytes > 0 {
+			p.metrics.compressionRatio.Observe(float64(p.compressedBytes) / float64(p.payloadBytes))
+		}
+	}
+	if p.sealer != nil {
+		return p.sealer.Close()
+	}
+	return nil
+}
+
+// start sends the hello, announcing compression if [compress] and signed if the exchange is, and any pending bytes
+func (p *payloadWriter) start(compress bool) error {
+	p.started = true
+	p.out = p.w
+	if p.hello != nil {
+		h := *p.hello
+		if compress {
+			h.compressions = []string{p.algorithm}
+		}
+		if p.auth != nil {
+			h = p.auth.sign(h)
+		}
+		if err := writeHello(p.w, h); err != nil {
+			return err
+		}
+		if p.auth != nil {
+			p.sealer = p.auth.seal(p.w, h)
+			p.out = p.sealer
+		}
+	}
+	if compress {
+		p.compressor = newCompressor(writeCounter{w: p.out, written: &p.compressedBytes}, p.algorithm)
+		p.out = p.compressor
+	}
+	pending := p.pending
+	p.pending = nil
+	if len(pending) == 0 {
+		return nil
+	}
+	_, err := p.Write(pending)
+	return err
+}
+
+// writeCounter counts the bytes written to [w]
+type writeCounter struct {
+	w io.Writer
+
+	written *int
+}
+
+func (c writeCounter) Write(b []byte) (int, error) {
+	written, err := c.w.Write(b)
+	*c.written += written
+	return written, err
+}
+
+// readCounter counts the bytes read from [r]
+type readCounter struct {
+	r io.Reader
+
+	read int64
+}
+
+func (c *readCounter) Read(b []byte) (int, error) {
+	read, err := c.r.Read(b)
+	c.read += int64(read)
+	return read, err
+}
+
+// payloadConn is the connection a Strategy answers a peer on, which sends what the Strategy writes through a payloadWriter
+type payloadConn struct {
+	net.Conn
+
+	payload *payloadWriter
+}
+
+func (c payloadConn) Write(b []byte) (int, error) {
+	return c.payload.Write(b)
+}
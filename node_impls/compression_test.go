@@ -0,0 +1,127 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var compressionTestHello = &hello{encodings: []objects.Encoding{objects.TextEncoding}}
+
+// readPayload reads the hello and the decompressed database sent by a payloadWriter
+func readPayload(t *testing.T, sent []byte) (hello, string) {
+	reader := bufio.NewReader(bytes.NewReader(sent))
+	h, found, err := readHello(reader)
+	require.NoError(t, err)
+	require.True(t, found)
+	algorithm, err := acceptedCompression(h, []string{config.GzipCompression, config.FlateCompression})
+	require.NoError(t, err)
+	payload, err := decompress(reader, algorithm)
+	require.NoError(t, err)
+	db, err := io.ReadAll(payload)
+	require.NoError(t, err)
+	return h, string(db)
+}
+
+func TestPayloadWriterSendsSmallDatabaseUncompressed(t *testing.T) {
+	var sent bytes.Buffer
+	metrics := newNodeMetrics(objects.InitializeDatabase())
+	payload, err := newPayloadWriter(&sent, compressionTestHello, nil, config.GzipCompression, 64, metrics)
+	require.NoError(t, err)
+
+	_, err = payload.Write([]byte("127.0.0.1:8080,1664228446,4\n"))
+	require.NoError(t, err)
+	require.Zero(t, sent.Len(), "the payload is held back until it is known whether it reaches the threshold")
+	require.NoError(t, payload.Close())
+
+	require.Equal(t, "GOSSIP/1 enc=text\n127.0.0.1:8080,1664228446,4\n", sent.String())
+	require.Zero(t, metrics.compressionRatio.Count())
+}
+
+func TestPayloadWriterCompressesLargeDatabase(t *testing.T) {
+	for _, algorithm := range []string{config.GzipCompression, config.FlateCompression} {
+		var sent bytes.Buffer
+		metrics := newNodeMetrics(objects.InitializeDatabase())
+		payload, err := newPayloadWriter(&sent, compressionTestHello, nil, algorithm, 64, metrics)
+		require.NoError(t, err)
+		dbStr := strings.Repeat("127.0.0.1:8080,1664228446,4\n", 100)
+
+		for _, line := range strings.SplitAfter(dbStr, "\n") {
+			_, err = payload.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		require.NoError(t, payload.Close())
+
+		h, received := readPayload(t, sent.Bytes())
+		require.Equal(t, []string{algorithm}, h.compressions)
+		require.Equal(t, dbStr, received)
+		require.Less(t, sent.Len(), len(dbStr) / 4)
+		require.Equal(t, float64(len(dbStr)), metrics.compressedPayloadBytes.Value())
+		require.Equal(t, uint64(1), metrics.compressionRatio.Count())
+	}
+}
+
+func TestPayloadWriterDoesNotHoldBackUncompressibleDatabase(t *testing.T) {
+	var sent bytes.Buffer
+	payload, err := newPayloadWriter(&sent, compressionTestHello, nil, "", 64, newNodeMetrics(objects.InitializeDatabase()))
+	require.NoError(t, err)
+
+	_, err = payload.Write([]byte("127.0.0.1:8080,1664228446,4\n"))
+
+	require.NoError(t, err)
+	require.Equal(t, "GOSSIP/1 enc=text\n127.0.0.1:8080,1664228446,4\n", sent.String())
+}
+
+func TestNodesGossipCompressedDatabases(t *testing.T) {
+	responderCfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	responderCfg.CompressionThreshold = 0
+	responder := startTestNode(t, responderCfg, 5)
+	pullerCfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	pullerCfg.Compression = config.FlateCompression
+	puller := startTestNode(t, pullerCfg, 4)
+
+	require.NoError(t, puller.AddPeer(responder.nodeID))
+
+	require.Equal(t, 2, puller.database.Size())
+	require.Equal(t, uint64(1), responder.metrics.compressionRatio.Count())
+	h, received := readPayload(t, []byte(pullRaw(t, responder, "GOSSIP/1 enc=text comp=gzip\n")))
+	require.Equal(t, []string{config.GzipCompression}, h.compressions)
+	require.Equal(t, responder.database.Serialize(), received)
+}
+
+func TestPullLimitsDecompressedDatabase(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	bomb, err := objects.DeserializeNodeID(ln.Addr().String())
+	require.NoError(t, err)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// a few KiB that decompress to a 16MiB line
+		io.WriteString(conn, "GOSSIP/1 enc=text comp=gzip\n")
+		compressor := gzip.NewWriter(conn)
+		compressor.Write(bytes.Repeat([]byte("9"), oversizedBytes))
+		compressor.Close()
+	}()
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	cfg.Compression = config.GzipCompression
+	node := startTestNode(t, cfg, 4)
+
+	err = node.AddPeer(bomb)
+
+	require.ErrorIs(t, err, objects.EntryTooLarge)
+	require.Less(t, node.metrics.bytesReceived.Value(), float64(oversizedBytes / 100))
+}
@@ -0,0 +1,43 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"net"
+	"net/netip"
+	"time"
+)
+
+// dialPeer connects to [peer] from the IP address the node binds to, so peers see the connection come from the node's own address
+// rather than whichever address the OS picks on a multi-homed host.
+// The OS picks the address if the node binds to an unspecified address or a hostname.
+func dialPeer(peer objects.NodeID, cfg *config.Config) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: time.Duration(cfg.DialTimeout)}
+	if addr, found := bindAddr(cfg); found {
+		dialer.LocalAddr = &net.TCPAddr{IP: addr.AsSlice(), Zone: addr.Zone()}
+	}
+	return dialer.Dial("tcp", peer.Serialize())
+}
+
+// dialDatagram connects a UDP socket to [peer] from the IP address the node binds to, like dialPeer
+func dialDatagram(peer objects.NodeID, cfg *config.Config) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: time.Duration(cfg.DialTimeout)}
+	if addr, found := bindAddr(cfg); found {
+		dialer.LocalAddr = &net.UDPAddr{IP: addr.AsSlice(), Zone: addr.Zone()}
+	}
+	return dialer.Dial("udp", peer.Serialize())
+}
+
+// bindAddr returns the IP address the node binds to, false if it binds to an unspecified address or a hostname
+func bindAddr(cfg *config.Config) (netip.Addr, bool) {
+	bindID, err := cfg.ListenNodeID()
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(string(bindID.IP))
+	if err != nil || addr.IsUnspecified() {
+		return netip.Addr{}, false
+	}
+	return addr, true
+}
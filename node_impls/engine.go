@@ -0,0 +1,878 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/metrics"
+	"github.com/tedim52/gossip_two/node_interface"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+	"github.com/tedim52/gossip_two/storage"
+
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// invalid entries listed when logging a database with invalid entries
+	maxSummarizedEntryErrors = 5
+)
+
+// mergeFunc is how a node merges [peerDB], pulled from [peer], into its own database [n.database].
+// Returns the NodeIDs whose entries were updated.
+type mergeFunc func(n *engine, peerDB *objects.Database, peer objects.NodeID) []objects.NodeID
+
+// engine is the core every gossip node is built on: it pulls peers' databases every [config.Interval], answers peers
+// pulling its own database, and keeps its peers, blacklist and persisted state.
+// Node implementations differ only in their hooks:
+// - [inbound] answers a peer pulling this node's database
+// - [outbound] merges a database pulled from a peer
+//
+// Invariants:
+// - The max number of [nodeID]'s in [database], with the same ip address (different port number) should be [config.MaxPortsPerIP]
+// - Once something is added to [blacklist], it can't be removed.
+type engine struct {
+	nodeID objects.NodeID
+
+	// identity stays the same when the node restarts at a different [nodeID], stored in [config.DataDir] if set
+	identity objects.Identity
+
+	// mode is reported in the node's status, either node_interface.HealthyMode or node_interface.AdverserialMode
+	mode string
+
+	inbound Strategy
+
+	outbound mergeFunc
+
+	database *objects.Database
+
+	peers map[objects.NodeID]struct{}
+
+	blacklist map[objects.NodeID]struct{}
+
+	logger logging.Logger
+
+	metrics *nodeMetrics
+
+	startedAt time.Time
+
+	config *config.Config
+
+	// store persists the node's state to [config.DataDir], nil if no data directory is configured
+	store *storage.Store
+
+	// wal records updates made since the last snapshot, nil if [store] is nil
+	wal *storage.WAL
+
+	// tls authenticates the node's exchanges with peers, nil if nodes gossip over plaintext TCP
+	tls *clusterTLS
+
+	// auth authenticates the node's exchanges with peers sharing its cluster key, nil if the node has none
+	auth *clusterAuth
+
+	listener net.Listener
+
+	// pool holds the persistent connections to peers, see fetch
+	pool *connPool
+
+	// udpBackoff remembers peers that didn't answer over UDP
+	udpBackoff *udpBackoff
+
+	// onUpdate is called with the entries whose value changed, nil if unset, see OnUpdate
+	onUpdate func(objects.NodeID, objects.GossipValue)
+
+	// packetConn answers peers over UDP, nil if [config.UDP] is off
+	packetConn net.PacketConn
+
+	// closed on Shutdown to stop the gossip and listen loops
+	done chan struct{}
+
+	shutdownOnce sync.Once
+
+	wg sync.WaitGroup
+
+	mutex sync.Mutex
+}
+
+// newEngine creates a node core listening on [cfg.ListenAddr] and identified by [cfg.AdvertiseNodeID], with the given hooks.
+// Returns an error if [cfg] is invalid.
+func newEngine(cfg *config.Config, logger logging.Logger, mode string, inbound Strategy, outbound mergeFunc) (*engine, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	nodeID, err := cfg.AdvertiseNodeID()
+	if err != nil {
+		return nil, err
+	}
+	db := objects.NewDatabase(cfg.MaxPortsPerIP)
+	db.EnableHistory(cfg.HistorySize)
+	var store *storage.Store
+	var wal *storage.WAL
+	if cfg.DataDir != "" {
+		store, err = storage.NewStore(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		wal, err = store.OpenWAL()
+		if err != nil {
+			return nil, err
+		}
+	}
+	identity, err := loadIdentity(store)
+	if err != nil {
+		return nil, err
+	}
+	clusterTLS, err := loadClusterTLS(cfg, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &engine{
+		nodeID: nodeID,
+		identity: identity,
+		mode: mode,
+		inbound: inbound,
+		outbound: outbound,
+		database: db,
+		peers: make(map[objects.NodeID]struct{}),
+		blacklist: make(map[objects.NodeID]struct{}),
+		logger: logger.With(logging.NodeKey, nodeID.Serialize()),
+		metrics: newNodeMetrics(db),
+		config: cfg,
+		store: store,
+		wal: wal,
+		tls: clusterTLS,
+		auth: newClusterAuth(cfg.ClusterKey),
+		udpBackoff: newUDPBackoff(),
+		done: make(chan struct{}),
+	}
+	// readers of persistent connections are waited for on Shutdown like every other goroutine of the node
+	n.pool = newConnPool(&n.wg)
+	return n, nil
+}
+
+func (n *engine) BoostrapNode() error {
+	// rejoin the cluster with the state from before the last restart
+	if err := n.restore(); err != nil {
+		return err
+	}
+	// peers still know this node by its address before the restart
+	if prevID, moved := moveIdentity(n.database, n.identity, n.nodeID); moved {
+		n.logger.Info("node moved to a new address", "previous", prevID.Serialize())
+		n.logUpdates(n.nodeID)
+	}
+
+	// setup listener
+	ln, err := net.Listen("tcp", n.config.ListenAddr)
+	if err != nil {
+		return err
+	}
+	if n.tls != nil {
+		ln = tls.NewListener(ln, n.tls.serverConfig())
+	}
+	// adverserial nodes only answer over TCP, where their strategy runs
+	var pc net.PacketConn
+	if n.config.UDP && n.mode == node_interface.HealthyMode {
+		pc, err = net.ListenPacket("udp", n.config.ListenAddr)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	n.mutex.Lock()
+	n.listener = ln
+	n.packetConn = pc
+	n.startedAt = time.Now()
+	n.mutex.Unlock()
+
+	// start listening on this node
+	n.wg.Add(2)
+	go n.listen(ln)
+	if pc != nil {
+		n.wg.Add(1)
+		go n.listenUDP(pc)
+	}
+
+	// start gossiping every [config.Interval]
+	go func(){
+		defer n.wg.Done()
+		ticker := time.NewTicker(time.Duration(n.config.Interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.done:
+				return
+			case <-ticker.C:
+				n.gossip()
+			}
+		}
+	}()
+
+	// start snapshotting every [config.SnapshotInterval]
+	if n.store != nil {
+		n.wg.Add(1)
+		go func(){
+			defer n.wg.Done()
+			ticker := time.NewTicker(time.Duration(n.config.SnapshotInterval))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-n.done:
+					return
+				case <-ticker.C:
+					n.saveSnapshot()
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+func (n *engine) Shutdown() {
+	n.shutdownOnce.Do(func(){
+		close(n.done)
+		n.mutex.Lock()
+		ln := n.listener
+		pc := n.packetConn
+		n.mutex.Unlock()
+		if ln != nil {
+			ln.Close()
+		}
+		if pc != nil {
+			pc.Close()
+		}
+		n.pool.closeAll()
+	})
+	n.wg.Wait()
+	n.saveSnapshot()
+	if n.wal != nil {
+		if err := n.wal.Close(); err != nil {
+			n.logger.Warn("closing write-ahead log failed", logging.ErrorKey, err)
+		}
+	}
+}
+
+// restore merges the last snapshot in the data directory, if any, and the updates logged after it into the node's state
+func (n *engine) restore() error {
+	if n.store == nil {
+		return nil
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	snap, err := restoreSnapshot(n.store, n.database, n.peers, n.blacklist)
+	if err != nil {
+		return err
+	}
+	if snap != nil {
+		n.metrics.blacklistSize.Set(float64(len(n.blacklist)))
+		n.logger.Info("restored snapshot", "taken_at", snap.TakenAt, "entries", snap.Database.Size(), "peers", len(snap.Peers))
+	}
+
+	// a corrupt tail (ex. from crashing mid write) is truncated from the log and only warned about
+	replayed, err := n.wal.Replay(n.database)
+	if err != nil && !isCorruptWAL(err) {
+		return err
+	}
+	if err != nil {
+		n.logger.Warn("write-ahead log has a corrupt tail, dropped it", "replayed", replayed, logging.ErrorKey, err)
+	} else if replayed > 0 {
+		n.logger.Info("replayed write-ahead log", "replayed", replayed)
+	}
+	return nil
+}
+
+// saveSnapshot persists the node's database, peers and blacklist to the data directory
+func (n *engine) saveSnapshot() {
+	if n.store == nil {
+		return
+	}
+	n.mutex.Lock()
+	snap := newSnapshot(n.database, n.peers, n.blacklist)
+	n.mutex.Unlock()
+
+	// the log is compacted since every update in it is part of the new snapshot
+	err := n.wal.Compact(func() error {
+		return n.store.SaveSnapshot(snap)
+	})
+	if err != nil {
+		n.logger.Warn("saving snapshot failed", logging.ErrorKey, err)
+	}
+}
+
+// logUpdates logs the current entries of [ids] and records them in the write-ahead log, if the node has a data directory
+func (n *engine) logUpdates(ids ...objects.NodeID) {
+	for _, id := range ids {
+		gossipVal, _ := n.database.GetGossipValue(id)
+		n.logger.Debug("database entry updated", logging.NodeKey, id.Serialize(), "value", gossipVal.Serialize())
+	}
+	if n.wal == nil || len(ids) == 0 {
+		return
+	}
+	if err := appendWAL(n.wal, n.database, ids); err != nil {
+		n.logger.Warn("appending to write-ahead log failed", logging.ErrorKey, err)
+	}
+}
+
+// gossip pulls the database of a random peer and merges it into this node's database.
+// With [config.UDP], the databases' digests are compared over UDP first, and the database is only pulled over TCP if they differ and
+// it doesn't fit in a datagram. Peers that don't answer over UDP are only asked again once their backoff expires, see udpBackoff.
+// [n.mutex] isn't held while waiting on the peer, so the node keeps serving its API and adding peers meanwhile.
+func (n *engine) gossip() {
+	start := time.Now()
+	n.metrics.gossipRounds.Inc()
+
+	n.mutex.Lock()
+	peer, found := n.getRandomPeerNodeID()
+	_, blacklisted := n.blacklist[peer]
+	n.mutex.Unlock()
+	if !found {
+		return
+	}
+	// Check that this node is not in the blacklist
+	if blacklisted {
+		return
+	}
+	// Check that this peer is not itself
+	if peer.NodeID == n.nodeID.NodeID {
+		return
+	}
+
+	if n.config.UDP && n.udpBackoff.allows(peer, start) {
+		peerDB, pulled, err := n.pullDatagram(peer)
+		if errors.Is(err, NoDatagramAnswer) {
+			n.udpBackoff.failed(peer, start)
+			n.logger.Debug("peer didn't answer over UDP, pulling over TCP until its backoff expires", logging.PeerKey, peer.Serialize())
+		} else if err != nil {
+			n.logger.Warn("pulling database from peer over UDP failed", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+			return
+		} else {
+			n.udpBackoff.answered(peer)
+		}
+		if pulled {
+			entries := 0
+			if peerDB != nil {
+				n.merge(peerDB, peer)
+				entries = peerDB.Size()
+			}
+			n.metrics.udpExchanges.Inc()
+			n.metrics.observeExchange(start)
+			n.logger.Debug("gossip exchange over UDP complete", logging.PeerKey, peer.Serialize(), logging.DurationKey, time.Since(start), "entries", entries)
+			return
+		}
+		n.metrics.udpFallbacks.Inc()
+	}
+
+	peerDB, connected, err := n.fetch(peer)
+	if !connected {
+		n.logger.Warn("dialing peer failed, blacklisting it", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+		return
+	}
+	if err != nil {
+		n.logger.Warn("pulling database from peer failed", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+		return
+	}
+	n.merge(peerDB, peer)
+
+	n.metrics.observeExchange(start)
+	n.logger.Debug("gossip exchange complete", logging.PeerKey, peer.Serialize(), logging.DurationKey, time.Since(start), "entries", peerDB.Size())
+}
+
+// upsert upserts [peerDB], pulled from [peer], into this node's database.
+// Without a cluster key or TLS anyone can pose as a peer, so identities in [peerDB] aren't trusted to move nodes to a new NodeID.
+func (n *engine) upsert(peerDB *objects.Database, peer objects.NodeID) []objects.NodeID {
+	if n.auth == nil && n.tls == nil {
+		return n.database.UpsertUnauthenticatedFrom(peerDB, peer)
+	}
+	return n.database.UpsertFrom(peerDB, peer)
+}
+
+// merge merges [peerDB], pulled from [peer], into this node's database with the [outbound] hook
+func (n *engine) merge(peerDB *objects.Database, peer objects.NodeID) {
+	n.mutex.Lock()
+	onUpdate := n.onUpdate
+	var prev map[objects.NodeID]objects.GossipValue
+	if onUpdate != nil {
+		prev = n.values(peerDB.GetNodeIDs())
+	}
+	updated := n.outbound(n, peerDB, peer)
+	n.logUpdates(updated...)
+	n.mutex.Unlock()
+
+	n.reportChanges(onUpdate, prev, updated)
+}
+
+// values returns the values this node has for [ids], leaving out the ones it has no entry for
+func (n *engine) values(ids []objects.NodeID) map[objects.NodeID]objects.GossipValue {
+	values := make(map[objects.NodeID]objects.GossipValue, len(ids))
+	for _, id := range ids {
+		if gossipVal, found := n.database.GetGossipValue(id); found {
+			values[id] = gossipVal
+		}
+	}
+	return values
+}
+
+// reportChanges calls [onUpdate], if set, with every entry of [updated] whose value isn't the one it had in [prev].
+// Entries that weren't in [prev] are new rather than changed, and aren't reported.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) reportChanges(onUpdate func(objects.NodeID, objects.GossipValue), prev map[objects.NodeID]objects.GossipValue, updated []objects.NodeID) {
+	if onUpdate == nil {
+		return
+	}
+	for _, id := range updated {
+		prevVal, found := prev[id]
+		gossipVal, _ := n.database.GetGossipValue(id)
+		if found && prevVal.GetValue() != gossipVal.GetValue() {
+			onUpdate(id, gossipVal)
+		}
+	}
+}
+
+// fetch pulls the database of [peer], over the persistent connection to it if [config.PersistentConnections], see connect.
+// A persistent connection the peer closed since the last exchange, ex. because it restarted, is reopened.
+// Returns false if dialing [peer] failed.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) fetch(peer objects.NodeID) (*objects.Database, bool, error) {
+	if !n.config.PersistentConnections {
+		conn, err := n.dial(peer)
+		if err != nil {
+			return nil, false, err
+		}
+		defer conn.Close()
+		peerDB, err := n.pull(conn, peer)
+		return peerDB, true, err
+	}
+	if mc, found := n.pool.get(peer); found {
+		peerDB, err := n.pullMux(mc, peer)
+		if !errors.Is(err, ConnectionClosed) {
+			return peerDB, true, err
+		}
+		n.metrics.reconnects.Inc()
+		n.logger.Debug("connection to peer closed, reconnecting", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+	}
+	return n.connect(peer)
+}
+
+// dial connects to [peer] with a read deadline of [config.ReadTimeout] for the whole exchange, blacklisting [peer] if that fails.
+// Over TLS, [peer] must authenticate as itself.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) dial(peer objects.NodeID) (net.Conn, error) {
+	conn, err := dialPeer(peer, n.config)
+	if err == nil && n.tls != nil {
+		conn, err = n.tls.client(conn, peer, time.Duration(n.config.DialTimeout))
+		if err != nil {
+			n.metrics.authenticationFailures.Inc()
+		}
+	}
+	if err == nil {
+		err = conn.SetReadDeadline(time.Now().Add(time.Duration(n.config.ReadTimeout)))
+		if err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		n.mutex.Lock()
+		n.blacklist[peer] = struct{}{}
+		n.metrics.blacklistSize.Set(float64(len(n.blacklist)))
+		n.mutex.Unlock()
+		return nil, err
+	}
+	n.metrics.connectionsOpened.Inc()
+	return conn, nil
+}
+
+// pull negotiates an encoding and compression with [peer], which must be in this node's cluster, and decodes its database from [conn],
+// see decode.
+func (n *engine) pull(conn io.ReadWriter, peer objects.NodeID) (*objects.Database, error) {
+	offered, exchange, err := n.request(n.offer())
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHello(conn, offered); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReaderSize(conn, maxHelloBytes)
+	peerHello, found, err := readHello(reader)
+	if err != nil {
+		n.metrics.deserializationFailures.Inc()
+		return nil, err
+	}
+	return n.readAnswer(reader, peerHello, found, offered, exchange, peer)
+}
+
+// offer returns the hello a puller sends with the encodings and compressions it accepts
+func (n *engine) offer() hello {
+	return hello{
+		encodings: offeredEncodings(n.config.WireEncoding()),
+		compressions: offeredCompressions(n.config.Compression),
+	}
+}
+
+// readAnswer decodes the database [peer] sent from [reader] after its hello [h], answering the hello [offered].
+func (n *engine) readAnswer(reader *bufio.Reader, h hello, found bool, offered hello, exchange *exchangeAuth, peer objects.NodeID) (*objects.Database, error) {
+	if err := n.checkAnswer(h, found, exchange, peer); err != nil {
+		return nil, err
+	}
+	enc, err := acceptedEncoding(h, found, offered.encodings)
+	algorithm := ""
+	if err == nil {
+		algorithm, err = acceptedCompression(h, offered.compressions)
+	}
+	wire := &readCounter{r: reader}
+	var payload io.Reader = wire
+	if exchange != nil {
+		payload = exchange.open(wire, h)
+	}
+	if err == nil {
+		payload, err = decompress(payload, algorithm)
+	}
+	if err != nil {
+		n.metrics.deserializationFailures.Inc()
+		return nil, err
+	}
+	peerDB, err := n.decode(payload, enc, peer)
+	n.metrics.bytesReceived.Add(float64(wire.read))
+	return peerDB, err
+}
+
+// request completes the hello [h] a puller sends with this node's NodeID and cluster, and signs it if the node has a cluster key,
+// returning the exchange that verifies the answer.
+func (n *engine) request(h hello) (hello, *exchangeAuth, error) {
+	h.from = n.nodeID
+	h.cluster = n.config.Cluster
+	if n.auth == nil {
+		return h, nil, nil
+	}
+	return n.auth.signRequest(h)
+}
+
+// checkAnswer checks that the hello [h] answering a request was signed for [exchange], if any, and that [peer] is in this node's
+// cluster, dropping [peer] if it isn't.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) checkAnswer(h hello, found bool, exchange *exchangeAuth, peer objects.NodeID) error {
+	if exchange != nil {
+		if err := exchange.verify(h, found); err != nil {
+			n.metrics.authenticationFailures.Inc()
+			return err
+		}
+	}
+	if err := checkCluster(h, n.config.Cluster); err != nil {
+		// the peer won't ever join this node's cluster
+		n.mutex.Lock()
+		delete(n.peers, peer)
+		n.mutex.Unlock()
+		n.metrics.clusterMismatches.Inc()
+		return err
+	}
+	return nil
+}
+
+// decode decodes the database [peer] sent in [payload] within [config.DecoderLimits], which apply to the decompressed database.
+// A database cut short, by reaching [config.MaxLinesToRead] or the peer hanging up mid entry, is returned up to where it was cut.
+// With lenient validation, invalid entries are skipped and reported instead of dropping the whole database.
+func (n *engine) decode(payload io.Reader, enc objects.Encoding, peer objects.NodeID) (*objects.Database, error) {
+	decoder := objects.NewEncodingDecoder(payload, enc, n.config.DecoderLimits())
+	if n.config.Validation == config.LenientValidation {
+		decoder.SkipInvalidEntries()
+	}
+	peerDB, err := decoder.Decode()
+	if skipped := decoder.Skipped(); len(skipped) > 0 {
+		n.metrics.skippedEntries.Add(float64(len(skipped)))
+		n.logger.Warn("peer sent invalid entries, skipped them", logging.PeerKey, peer.Serialize(), "skipped", len(skipped), "errors", summarizeEntryErrors(skipped))
+	}
+	if errors.Is(err, objects.TooManyEntries) || errors.Is(err, objects.TruncatedEntry) {
+		n.logger.Debug("peer sent a partial database", logging.PeerKey, peer.Serialize(), logging.ErrorKey, err)
+		return peerDB, nil
+	}
+	if err != nil {
+		n.metrics.deserializationFailures.Inc()
+		return nil, err
+	}
+	return peerDB, nil
+}
+
+// summarizeEntryErrors lists the first [maxSummarizedEntryErrors] of [errs] on one line
+func summarizeEntryErrors(errs []objects.EntryError) string {
+	summary := make([]string, 0, maxSummarizedEntryErrors + 1)
+	for i, err := range errs {
+		if i == maxSummarizedEntryErrors {
+			summary = append(summary, fmt.Sprintf("and %d more", len(errs) - maxSummarizedEntryErrors))
+			break
+		}
+		summary = append(summary, err.Error())
+	}
+	return strings.Join(summary, "; ")
+}
+
+func (n *engine) listen(ln net.Listener) {
+	defer n.wg.Done()
+	defer ln.Close()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.logger.Warn("accepting connection failed", logging.ErrorKey, err)
+			continue
+		}
+
+		n.wg.Add(1)
+		go n.respond(conn)
+	}
+}
+
+// respond answers a peer pulling this node's database, over a persistent connection if the peer asks for one, see serveMux
+func (n *engine) respond(conn net.Conn) {
+	defer n.wg.Done()
+	defer conn.Close()
+
+	// unblock the response on shutdown
+	responded := make(chan struct{})
+	defer close(responded)
+	go func(){
+		select {
+		case <-n.done:
+			conn.Close()
+		case <-responded:
+		}
+	}()
+
+	certs, err := acceptTLS(conn, time.Duration(n.config.ReadTimeout))
+	if err != nil {
+		n.metrics.authenticationFailures.Inc()
+		n.logger.Warn("TLS handshake with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return
+	}
+	counted := countingConn{Conn: conn, onWrite: func(written int) {
+		n.metrics.bytesSent.Add(float64(written))
+	}}
+	reader := bufio.NewReaderSize(counted, maxHelloBytes)
+	peerHello, found, err := readRequest(counted, reader)
+	if err != nil {
+		n.logger.Warn("negotiating with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return
+	}
+	// adverserial nodes answer every peer like an older node would
+	if found && peerHello.mux && n.mode == node_interface.HealthyMode {
+		n.serveMux(counted, reader, peerHello, certs)
+		return
+	}
+	n.answer(counted, peerHello, found, certs)
+}
+
+// answer answers the request [h] a peer pulling this node's database sent on [conn] with the [inbound] hook
+func (n *engine) answer(conn net.Conn, h hello, found bool, certs []*x509.Certificate) error {
+	enc, payload, err := n.negotiate(conn, h, found, certs)
+	if err != nil {
+		n.logger.Warn("negotiating with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return err
+	}
+	ctx := StrategyContext{
+		NodeID: n.nodeID,
+		Database: n.database,
+		Done: n.done,
+		Encoding: enc,
+	}
+	err = n.inbound.Respond(payloadConn{Conn: conn, payload: payload}, ctx)
+	if err == nil {
+		err = payload.Close()
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		n.logger.Warn("sending database failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+	}
+	return err
+}
+
+// negotiate picks the encoding to send the database in to the peer that sent the hello [h] on [conn], returning the payloadWriter
+// that answers the hello and sends the database, compressed if the peer asked for it and the database reaches
+// [config.CompressionThreshold]. Older nodes, that don't send a hello, are sent the text encoding without a hello. See admit.
+func (n *engine) negotiate(conn net.Conn, h hello, found bool, certs []*x509.Certificate) (objects.Encoding, *payloadWriter, error) {
+	exchange, err := n.admit(conn, h, found, certs)
+	if err != nil {
+		return "", nil, err
+	}
+	if !found {
+		payload, err := newPayloadWriter(conn, nil, nil, "", 0, n.metrics)
+		return objects.TextEncoding, payload, err
+	}
+	enc := negotiateEncoding(h.encodings)
+	algorithm := ""
+	if len(h.compressions) > 0 {
+		algorithm = h.compressions[0]
+	}
+	payload, err := newPayloadWriter(conn, &hello{encodings: []objects.Encoding{enc}, cluster: n.config.Cluster}, exchange, algorithm, n.config.CompressionThreshold, n.metrics)
+	return enc, payload, err
+}
+
+// admit checks that the peer that sent the hello [h] on [conn] can pull this node's database, returning the exchange that signs
+// the answer if the node has a cluster key.
+// Over TLS, the peer must have connected with [certs] issued to the NodeID in its hello, and with a cluster key its hello must be
+// signed with it. Older nodes are sent nothing in either case.
+// Peers of another cluster are only sent this node's cluster, older nodes are in the unnamed cluster.
+func (n *engine) admit(conn io.Writer, h hello, found bool, certs []*x509.Certificate) (*exchangeAuth, error) {
+	if n.tls != nil {
+		if err := n.tls.authenticate(h, found, certs); err != nil {
+			n.metrics.authenticationFailures.Inc()
+			return nil, err
+		}
+	}
+	var exchange *exchangeAuth
+	if n.auth != nil {
+		var err error
+		if exchange, err = n.auth.verifyRequest(h, found); err != nil {
+			n.metrics.authenticationFailures.Inc()
+			return nil, err
+		}
+	}
+	if err := checkCluster(h, n.config.Cluster); err != nil {
+		n.metrics.clusterMismatches.Inc()
+		// tell the puller which cluster this node is in instead of a database, so it knows why
+		if found {
+			answer := hello{cluster: n.config.Cluster}
+			if exchange != nil {
+				answer = exchange.sign(answer)
+			}
+			writeHello(conn, answer)
+		}
+		return nil, err
+	}
+	return exchange, nil
+}
+
+func (n *engine) AddPeer(peer objects.NodeID) error {
+	start := time.Now()
+	n.mutex.Lock()
+	// Check that this node is not in the blacklist
+	if _, found := n.blacklist[peer]; found {
+		n.mutex.Unlock()
+		return node_interface.PeerBlacklisted
+	}
+
+	// add node to peer set, unless it can't be reached
+	_, known := n.peers[peer]
+	n.peers[peer] = struct{}{}
+	n.mutex.Unlock()
+
+	peerDB, connected, err := n.fetch(peer)
+	if !connected && !known {
+		n.mutex.Lock()
+		delete(n.peers, peer)
+		n.mutex.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	n.merge(peerDB, peer)
+	n.metrics.observeExchange(start)
+
+	return nil
+}
+
+func (n *engine) RemovePeer(peer objects.NodeID) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, found := n.peers[peer]; !found {
+		return node_interface.PeerNotFound
+	}
+	delete(n.peers, peer)
+	return nil
+}
+
+func (n *engine) UpdateValue(v int64) {
+	n.mutex.Lock()
+	onUpdate := n.onUpdate
+	n.mutex.Unlock()
+
+	prev := n.values([]objects.NodeID{n.nodeID})
+	gossipValue := objects.NewGossipValue(time.Now(), v).WithIdentity(n.identity)
+	if n.database.SetGossipValueFrom(n.nodeID, gossipValue, n.nodeID) {
+		n.logUpdates(n.nodeID)
+		n.reportChanges(onUpdate, prev, []objects.NodeID{n.nodeID})
+	}
+}
+
+func (n *engine) OnUpdate(handler func(objects.NodeID, objects.GossipValue)) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.onUpdate = handler
+}
+
+func (n *engine) GetDatabase() *objects.Database {
+	return n.database
+}
+
+func (n *engine) GetPeers() []objects.NodeID {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return nodeIDSetToList(n.peers)
+}
+
+func (n *engine) GetBlacklist() []objects.NodeID {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return nodeIDSetToList(n.blacklist)
+}
+
+func (n *engine) GetStatus() node_interface.NodeStatus {
+	// the database has its own lock, hashing it under [n.mutex] would hold up peers and gossip rounds
+	status := node_interface.NodeStatus{
+		NodeID: n.nodeID,
+		Identity: n.identity,
+		ListenAddr: n.config.ListenAddr,
+		Mode: n.mode,
+		DatabaseSize: n.database.Size(),
+		DatabaseHash: n.database.Hash(),
+		LastSuccessfulExchange: n.metrics.lastSuccessfulExchangeTime(),
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	status.NumPeers = len(n.peers)
+	status.NumBlacklisted = len(n.blacklist)
+	status.StartedAt = n.startedAt
+	return status
+}
+
+func (n *engine) GetMetrics() *metrics.Registry {
+	return n.metrics.registry
+}
+
+func (n *engine) getRandomPeerNodeID() (objects.NodeID, bool) {
+	if len(n.peers) == 0 {
+		return objects.NodeID{}, false
+	}
+	var nodeID objects.NodeID
+	for id, _ := range n.peers {
+		nodeID = id
+	}
+	return nodeID, true
+}
+
+// nodeIDSetToList returns the NodeIDs in [set] sorted by their serialized form
+func nodeIDSetToList(set map[objects.NodeID]struct{}) []objects.NodeID {
+	nodeIDs := make([]objects.NodeID, 0, len(set))
+	for id := range set {
+		nodeIDs = append(nodeIDs, id)
+	}
+	objects.SortNodeIDs(nodeIDs)
+	return nodeIDs
+}
@@ -0,0 +1,276 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// every hello starts with the protocol name and version, older nodes that don't send one answer with their database right away
+	protocolName = "GOSSIP/"
+	protocolVersion = protocolName + "1"
+	// a hello is one short line, anything longer isn't one
+	maxHelloBytes = 512
+	// how long a responder waits for the puller's hello before answering it like an older node that doesn't send one
+	helloTimeout = 500 * time.Millisecond
+
+	helloParamDelimeter = " "
+	helloValueDelimeter = "="
+	helloListDelimeter = ","
+
+	// encodings the puller accepts, most preferred first, or the encoding the responder chose
+	encodingParam = "enc"
+	// compression algorithms the puller can decompress, or the algorithm the responder compressed its database with.
+	// Left out if the database isn't compressed.
+	compressionParam = "comp"
+	// '1' if the puller asks to keep the connection open for more requests, or the responder agreed to, see muxConn
+	muxParam = "mux"
+	// the NodeID of the puller, which must match its certificate if nodes gossip over TLS
+	fromParam = "from"
+	// the name of the cluster the node belongs to, left out by nodes of the unnamed cluster
+	clusterParam = "cluster"
+	// the hash of the sender's database, in exchanges over UDP
+	digestParam = "digest"
+	// a random nonce and the unix timestamp the puller sent its hello at, if nodes share a cluster key
+	nonceParam = "nonce"
+	timestampParam = "ts"
+	// the HMAC of every param before it with the cluster key, always the last param
+	macParam = "mac"
+)
+
+var (
+	InvalidHello = errors.New("Invalid hello from peer.")
+	UnsupportedProtocolVersion = errors.New("Peer speaks an unsupported version of the gossip protocol.")
+	ClusterMismatch = errors.New("Peer belongs to another cluster.")
+)
+
+// hello is the first line each side of an exchange sends, 'GOSSIP/1 key=value key=value'.
+// The puller sends the options it supports and the responder answers with the ones it chose, before sending its database.
+// Unknown params are ignored so newer nodes can add params older ones don't understand.
+type hello struct {
+	encodings []objects.Encoding
+
+	compressions []string
+
+	mux bool
+
+	// from is the zero NodeID in the responder's hello and in hellos of nodes that don't send one
+	from objects.NodeID
+
+	// cluster is empty for the unnamed cluster, which older nodes belong to
+	cluster string
+
+	digest string
+
+	nonce string
+
+	timestamp int64
+
+	mac string
+
+	// signed is what [mac] covers, the hello up to the mac param, see clusterAuth
+	signed string
+}
+
+func (h hello) String() string {
+	return h.line() + "\n"
+}
+
+// line is the hello without its newline
+func (h hello) line() string {
+	params := []string{protocolVersion}
+	encodings := make([]string, len(h.encodings))
+	for i, enc := range h.encodings {
+		encodings[i] = string(enc)
+	}
+	params = appendParam(params, encodingParam, encodings)
+	params = appendParam(params, compressionParam, h.compressions)
+	if h.mux {
+		params = appendParam(params, muxParam, []string{"1"})
+	}
+	if h.from != (objects.NodeID{}) {
+		params = appendParam(params, fromParam, []string{h.from.Serialize()})
+	}
+	if h.cluster != "" {
+		params = appendParam(params, clusterParam, []string{h.cluster})
+	}
+	if h.digest != "" {
+		params = appendParam(params, digestParam, []string{h.digest})
+	}
+	if h.nonce != "" {
+		params = appendParam(params, nonceParam, []string{h.nonce})
+		params = appendParam(params, timestampParam, []string{strconv.FormatInt(h.timestamp, 10)})
+	}
+	if h.mac != "" {
+		params = appendParam(params, macParam, []string{h.mac})
+	}
+	return strings.Join(params, helloParamDelimeter)
+}
+
+// appendParam appends 'key=value1,value2' to [params], unless there are no [values]
+func appendParam(params []string, key string, values []string) []string {
+	if len(values) == 0 {
+		return params
+	}
+	return append(params, key + helloValueDelimeter + strings.Join(values, helloListDelimeter))
+}
+
+func writeHello(w io.Writer, h hello) error {
+	_, err := io.WriteString(w, h.String())
+	return err
+}
+
+// readHello reads the hello at the start of [r].
+// Returns false if the peer sent something other than a hello or hung up without sending anything, which older nodes do.
+func readHello(r *bufio.Reader) (hello, bool, error) {
+	prefix, err := r.Peek(len(protocolName))
+	if errors.Is(err, io.EOF) || (err == nil && string(prefix) != protocolName) {
+		return hello{}, false, nil
+	}
+	if err != nil {
+		return hello{}, false, err
+	}
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || errors.Is(err, io.EOF) {
+		return hello{}, false, InvalidHello
+	}
+	if err != nil {
+		return hello{}, false, err
+	}
+	h, err := parseHello(strings.TrimSuffix(string(line), "\n"))
+	return h, true, err
+}
+
+func parseHello(line string) (hello, error) {
+	params := strings.Split(line, helloParamDelimeter)
+	if params[0] != protocolVersion {
+		return hello{}, UnsupportedProtocolVersion
+	}
+	h := hello{}
+	for i, param := range params[1:] {
+		key, value, found := strings.Cut(param, helloValueDelimeter)
+		if !found {
+			return hello{}, InvalidHello
+		}
+		switch key {
+		case encodingParam:
+			for _, name := range strings.Split(value, helloListDelimeter) {
+				// skip encodings added by newer nodes
+				if enc, err := objects.ParseEncoding(name); err == nil {
+					h.encodings = append(h.encodings, enc)
+				}
+			}
+		case compressionParam:
+			for _, algorithm := range strings.Split(value, helloListDelimeter) {
+				// skip algorithms added by newer nodes
+				if isCompressionAlgorithm(algorithm) {
+					h.compressions = append(h.compressions, algorithm)
+				}
+			}
+		case muxParam:
+			h.mux = value == "1"
+		case fromParam:
+			from, err := objects.DeserializeNodeID(value)
+			if err != nil {
+				return hello{}, InvalidHello
+			}
+			h.from = from
+		case clusterParam:
+			h.cluster = value
+		case digestParam:
+			h.digest = value
+		case nonceParam:
+			h.nonce = value
+		case timestampParam:
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return hello{}, InvalidHello
+			}
+			h.timestamp = timestamp
+		case macParam:
+			// params after the mac aren't signed
+			if i != len(params) - 2 {
+				return hello{}, InvalidHello
+			}
+			h.mac = value
+			h.signed = strings.Join(params[:i + 1], helloParamDelimeter)
+		}
+	}
+	return h, nil
+}
+
+// readRequest reads the hello of a puller from [reader], which reads [conn].
+// Returns false if the puller doesn't send one within [helloTimeout], like older nodes.
+func readRequest(conn net.Conn, reader *bufio.Reader) (hello, bool, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(helloTimeout)); err != nil {
+		return hello{}, false, err
+	}
+	h, found, err := readHello(reader)
+	if err != nil && !isTimeout(err) {
+		return hello{}, false, err
+	}
+	return h, found, conn.SetReadDeadline(time.Time{})
+}
+
+// checkCluster returns ClusterMismatch if the peer that sent [h] isn't in [cluster]
+func checkCluster(h hello, cluster string) error {
+	if h.cluster != cluster {
+		return fmt.Errorf("%w Peer is in '%s', this node in '%s'.", ClusterMismatch, h.cluster, cluster)
+	}
+	return nil
+}
+
+// negotiateEncoding returns the first of [offered] this node supports, or the text encoding every node supports
+func negotiateEncoding(offered []objects.Encoding) objects.Encoding {
+	if len(offered) == 0 {
+		return objects.TextEncoding
+	}
+	return offered[0]
+}
+
+// acceptedEncoding returns the encoding the responder chose in [h], which must be one of [offered].
+// Older nodes that didn't answer with a hello always send the text encoding.
+func acceptedEncoding(h hello, found bool, offered []objects.Encoding) (objects.Encoding, error) {
+	if !found {
+		return objects.TextEncoding, nil
+	}
+	if len(h.encodings) != 1 || !slices.Contains(offered, h.encodings[0]) {
+		return "", InvalidHello
+	}
+	return h.encodings[0], nil
+}
+
+// acceptedCompression returns the algorithm the responder compressed its database with in [h], which must be one of [offered],
+// or an empty string if the database isn't compressed.
+func acceptedCompression(h hello, offered []string) (string, error) {
+	if len(h.compressions) == 0 {
+		return "", nil
+	}
+	if len(h.compressions) != 1 || !slices.Contains(offered, h.compressions[0]) {
+		return "", InvalidHello
+	}
+	return h.compressions[0], nil
+}
+
+// offeredEncodings returns the encodings a puller preferring [preferred] offers, the text encoding always being last
+func offeredEncodings(preferred objects.Encoding) []objects.Encoding {
+	if preferred == objects.TextEncoding {
+		return []objects.Encoding{objects.TextEncoding}
+	}
+	return []objects.Encoding{preferred, objects.TextEncoding}
+}
+
+// isTimeout returns true if [err] is a read or write deadline passing
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
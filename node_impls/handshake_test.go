@@ -0,0 +1,162 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startTestNode starts a healthy node on a free port at 127.0.0.1 with [value] as its own value
+func startTestNode(t *testing.T, cfg *config.Config, value int64) *GossipNode {
+	node, err := NewHealthyGossipNode(cfg, logging.Discard())
+	require.NoError(t, err)
+	require.NoError(t, node.BoostrapNode())
+	t.Cleanup(node.Shutdown)
+	node.UpdateValue(value)
+	return node
+}
+
+// pullRaw connects to [node], sends [request] and returns everything the node answered
+func pullRaw(t *testing.T, node *GossipNode, request string) string {
+	conn, err := net.Dial("tcp", node.nodeID.Serialize())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5 * time.Second)))
+	_, err = io.WriteString(conn, request)
+	require.NoError(t, err)
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(response)
+}
+
+func TestParseHello(t *testing.T) {
+	h := hello{encodings: []objects.Encoding{objects.BinaryEncoding, objects.TextEncoding}}
+	require.Equal(t, "GOSSIP/1 enc=binary,text\n", h.String())
+
+	parsed, err := parseHello(strings.TrimSuffix(h.String(), "\n"))
+	require.NoError(t, err)
+	require.Equal(t, h, parsed)
+
+	// params and encodings added by newer nodes are skipped
+	parsed, err = parseHello("GOSSIP/1 enc=zstd,text color=blue")
+	require.NoError(t, err)
+	require.Equal(t, []objects.Encoding{objects.TextEncoding}, parsed.encodings)
+
+	_, err = parseHello("GOSSIP/2 enc=text")
+	require.ErrorIs(t, err, UnsupportedProtocolVersion)
+	_, err = parseHello("GOSSIP/1 text")
+	require.ErrorIs(t, err, InvalidHello)
+}
+
+func TestReadHelloLeavesDatabaseOfOlderNodes(t *testing.T) {
+	dbStr := "127.0.0.1:8080,1664228446,4\n"
+	reader := bufio.NewReader(strings.NewReader(dbStr))
+
+	_, found, err := readHello(reader)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, dbStr, string(rest))
+}
+
+func TestNodeSendsNegotiatedEncoding(t *testing.T) {
+	node := startTestNode(t, byzantineConfig(t, "127.0.0.1", config.StrictValidation), 4)
+
+	binaryResponse := pullRaw(t, node, "GOSSIP/1 enc=binary,text\n")
+	require.Equal(t, "GOSSIP/1 enc=binary\n" + string(node.database.Encode(objects.BinaryEncoding)), binaryResponse)
+
+	textResponse := pullRaw(t, node, "GOSSIP/1 enc=text\n")
+	require.Equal(t, "GOSSIP/1 enc=text\n" + node.database.Serialize(), textResponse)
+}
+
+func TestNodeAnswersOlderPullerInText(t *testing.T) {
+	node := startTestNode(t, byzantineConfig(t, "127.0.0.1", config.StrictValidation), 4)
+
+	response := pullRaw(t, node, "")
+
+	require.Equal(t, node.database.Serialize(), response)
+}
+
+func TestNodePullsFromOlderResponder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	olderNode, err := objects.DeserializeNodeID(ln.Addr().String())
+	require.NoError(t, err)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// older nodes answer with their database right away, ignoring the hello
+		io.WriteString(conn, olderNode.Serialize() + ",1664228446,7\n")
+	}()
+	node := startTestNode(t, byzantineConfig(t, "127.0.0.1", config.StrictValidation), 4)
+
+	require.NoError(t, node.AddPeer(olderNode))
+
+	gossipVal, found := node.database.GetGossipValue(olderNode)
+	require.True(t, found)
+	require.Equal(t, int64(7), gossipVal.GetValue())
+}
+
+func TestNodesPreferringDifferentEncodingsGossip(t *testing.T) {
+	textCfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	textCfg.Encoding = string(objects.TextEncoding)
+	textNode := startTestNode(t, textCfg, 4)
+	binaryNode := startTestNode(t, byzantineConfig(t, "127.0.0.1", config.StrictValidation), 5)
+
+	require.NoError(t, textNode.AddPeer(binaryNode.nodeID))
+	require.NoError(t, binaryNode.AddPeer(textNode.nodeID))
+
+	require.Equal(t, textNode.database.Serialize(), binaryNode.database.Serialize())
+	require.Equal(t, 2, binaryNode.database.Size())
+}
+
+func TestNodesOfDifferentClustersDontGossip(t *testing.T) {
+	clusterConfig := func(cluster string) *config.Config {
+		cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+		cfg.Cluster = cluster
+		return cfg
+	}
+	blue := startTestNode(t, clusterConfig("blue"), 4)
+	alsoBlue := startTestNode(t, clusterConfig("blue"), 5)
+	green := startTestNode(t, clusterConfig("green"), 6)
+	unnamed := startTestNode(t, clusterConfig(""), 7)
+
+	require.ErrorIs(t, blue.AddPeer(green.nodeID), ClusterMismatch)
+	require.ErrorIs(t, blue.AddPeer(unnamed.nodeID), ClusterMismatch)
+	require.ErrorIs(t, unnamed.AddPeer(blue.nodeID), ClusterMismatch)
+	require.NoError(t, blue.AddPeer(alsoBlue.nodeID))
+
+	require.Equal(t, []objects.NodeID{alsoBlue.nodeID}, blue.GetPeers())
+	require.Empty(t, unnamed.GetPeers())
+	require.Equal(t, 2, blue.database.Size())
+	require.Equal(t, 1, green.database.Size())
+	require.Equal(t, 1, unnamed.database.Size())
+	// twice pulling, once answering
+	require.Equal(t, float64(3), blue.metrics.clusterMismatches.Value())
+}
+
+func TestNodeAnswersPullerOfAnotherClusterWithItsCluster(t *testing.T) {
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	cfg.Cluster = "blue"
+	node := startTestNode(t, cfg, 4)
+
+	require.Equal(t, "GOSSIP/1 cluster=blue\n", pullRaw(t, node, "GOSSIP/1 enc=text cluster=green\n"))
+	require.Equal(t, "GOSSIP/1 cluster=blue\n", pullRaw(t, node, "GOSSIP/1 enc=text\n"))
+	require.Empty(t, pullRaw(t, node, ""))
+	require.Equal(t, "GOSSIP/1 enc=text cluster=blue\n" + node.database.Serialize(), pullRaw(t, node, "GOSSIP/1 enc=text cluster=blue\n"))
+}
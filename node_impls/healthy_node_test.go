@@ -0,0 +1,41 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeOnlyMergesHostnameEntryOfPeerItself(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	peer := objects.NewNodeID("node-1.example.com", "8080")
+	peerDB := objects.InitializeDatabase()
+	peerDB.SetGossipValue(peer, objects.NewGossipValue(time.Now(), 5))
+	peerDB.SetGossipValue(objects.NewNodeID("node-2.example.com", "8080"), objects.NewGossipValue(time.Now(), 6))
+	peerDB.SetGossipValue(objects.NewNodeID("127.0.0.2", "8080"), objects.NewGossipValue(time.Now(), 7))
+
+	node.merge(peerDB, peer)
+
+	require.ElementsMatch(t, []objects.NodeID{node.nodeID, peer, objects.NewNodeID("127.0.0.2", "8080")}, node.database.GetNodeIDs())
+}
+
+func TestNodeReportsChangedValuesToUpdateHandler(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	var changed []string
+	node.OnUpdate(func(id objects.NodeID, v objects.GossipValue) {
+		changed = append(changed, id.Serialize() + " --> " + v.GetValueString())
+	})
+	peer := objects.NewNodeID("127.0.0.2", "8080")
+	peerDB := objects.InitializeDatabase()
+	peerDB.SetGossipValue(peer, objects.NewGossipValue(time.Now().Add(-time.Minute), 5))
+	node.merge(peerDB, peer)
+
+	peerDB.SetGossipValue(peer, objects.NewGossipValue(time.Now(), 6))
+	node.merge(peerDB, peer)
+	node.UpdateValue(7)
+
+	require.Equal(t, []string{"127.0.0.2:8080 --> 6", node.nodeID.Serialize() + " --> 7"}, changed)
+}
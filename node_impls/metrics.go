@@ -0,0 +1,104 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/metrics"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"sync/atomic"
+	"time"
+)
+
+// compressionRatioBuckets are histogram upper bounds of the compressed size over the uncompressed size of a database
+var compressionRatioBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1}
+
+// nodeMetrics groups the metrics every gossip node implementation reports.
+type nodeMetrics struct {
+	registry *metrics.Registry
+
+	gossipRounds *metrics.Counter
+
+	exchangeLatency *metrics.Histogram
+
+	bytesSent *metrics.Counter
+
+	bytesReceived *metrics.Counter
+
+	deserializationFailures *metrics.Counter
+
+	skippedEntries *metrics.Counter
+
+	compressedPayloadBytes *metrics.Counter
+
+	compressedBytes *metrics.Counter
+
+	compressionRatio *metrics.Histogram
+
+	authenticationFailures *metrics.Counter
+
+	clusterMismatches *metrics.Counter
+
+	udpExchanges *metrics.Counter
+
+	udpFallbacks *metrics.Counter
+
+	connectionsOpened *metrics.Counter
+
+	reconnects *metrics.Counter
+
+	blacklistSize *metrics.Gauge
+
+	// unix nano timestamp of the last successful exchange, 0 if there hasn't been one
+	lastSuccessfulExchange int64
+}
+
+func newNodeMetrics(database *objects.Database) *nodeMetrics {
+	registry := metrics.NewRegistry()
+	m := &nodeMetrics{
+		registry: registry,
+		gossipRounds: registry.NewCounter("gossip_rounds_total", "Number of gossip rounds initiated by this node."),
+		exchangeLatency: registry.NewHistogram("gossip_exchange_duration_seconds", "Duration of successful database exchanges with peers.", metrics.DefaultLatencyBuckets),
+		bytesSent: registry.NewCounter("gossip_bytes_sent_total", "Number of database bytes sent to peers."),
+		bytesReceived: registry.NewCounter("gossip_bytes_received_total", "Number of database bytes received from peers."),
+		deserializationFailures: registry.NewCounter("gossip_deserialization_failures_total", "Number of databases received from peers that failed to deserialize."),
+		skippedEntries: registry.NewCounter("gossip_skipped_entries_total", "Number of invalid entries skipped in databases received from peers, with lenient validation."),
+		compressedPayloadBytes: registry.NewCounter("gossip_compressed_payload_bytes_total", "Number of database bytes sent to peers compressed, before compression."),
+		compressedBytes: registry.NewCounter("gossip_compressed_bytes_total", "Number of bytes sent to peers after compressing their database."),
+		compressionRatio: registry.NewHistogram("gossip_compression_ratio", "Compressed size over uncompressed size of databases sent compressed.", compressionRatioBuckets),
+		authenticationFailures: registry.NewCounter("gossip_authentication_failures_total", "Number of exchanges with peers that failed to authenticate."),
+		clusterMismatches: registry.NewCounter("gossip_cluster_mismatches_total", "Number of exchanges rejected because the peer belongs to another cluster."),
+		udpExchanges: registry.NewCounter("gossip_udp_exchanges_total", "Number of gossip rounds completed over UDP, without pulling the peer's database over TCP."),
+		udpFallbacks: registry.NewCounter("gossip_udp_fallbacks_total", "Number of gossip rounds that pulled the peer's database over TCP after asking over UDP."),
+		connectionsOpened: registry.NewCounter("gossip_connections_opened_total", "Number of connections opened to peers to pull their database."),
+		reconnects: registry.NewCounter("gossip_reconnects_total", "Number of persistent connections to peers reopened after they closed."),
+		blacklistSize: registry.NewGauge("gossip_blacklist_size", "Number of blacklisted peers."),
+	}
+	registry.NewGaugeFunc("gossip_database_size", "Number of entries in the database.", func() float64 {
+		return float64(database.Size())
+	})
+	registry.NewGaugeFunc("gossip_seconds_since_last_successful_exchange", "Seconds since the last successful exchange with a peer, -1 if there has been none.", m.secondsSinceLastSuccessfulExchange)
+	return m
+}
+
+// observeExchange records a successful exchange that started at [start].
+func (m *nodeMetrics) observeExchange(start time.Time) {
+	now := time.Now()
+	m.exchangeLatency.Observe(now.Sub(start).Seconds())
+	atomic.StoreInt64(&m.lastSuccessfulExchange, now.UnixNano())
+}
+
+// lastSuccessfulExchangeTime returns the time of the last successful exchange, zero if there has been none.
+func (m *nodeMetrics) lastSuccessfulExchangeTime() time.Time {
+	last := atomic.LoadInt64(&m.lastSuccessfulExchange)
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+func (m *nodeMetrics) secondsSinceLastSuccessfulExchange() float64 {
+	last := m.lastSuccessfulExchangeTime()
+	if last.IsZero() {
+		return -1
+	}
+	return time.Since(last).Seconds()
+}
@@ -0,0 +1,504 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// A puller that sends 'mux=1' in its first hello keeps the connection open if the responder answers with 'GOSSIP/1 mux=1'.
+// Both then send frames, '<uvarint stream id><uvarint length><data>': the puller sends each request, a hello, in a single frame with
+// a new stream id, and the responder answers it like it would on a connection of its own, in frames with the same stream id and
+// ending with an empty frame. Requests are answered concurrently, so the frames of their answers can interleave.
+// Older responders answer the first hello like any other, and the puller closes the connection once it read the answer.
+
+const (
+	// the largest frame of an answer, requests are a single hello
+	maxFrameBytes = 32 * 1024
+	// requests a responder answers at once on a connection, it stops reading requests on it until one is answered
+	maxConcurrentRequests = 16
+)
+
+var (
+	InvalidFrame = errors.New("Invalid frame from peer.")
+	ConnectionClosed = errors.New("Connection to peer closed.")
+)
+
+func writeFrame(w io.Writer, id uint64, data []byte) error {
+	frame := binary.AppendUvarint(nil, id)
+	frame = binary.AppendUvarint(frame, uint64(len(data)))
+	frame = append(frame, data...)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame of at most [maxBytes] from [r]. Returns io.EOF only if [r] ends between frames.
+func readFrame(r *bufio.Reader, maxBytes int) (uint64, []byte, error) {
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err == nil && length > uint64(maxBytes) {
+		err = InvalidFrame
+	}
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return id, data, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// frameWriter writes the frames of concurrent answers to one connection
+type frameWriter struct {
+	w io.Writer
+
+	mutex sync.Mutex
+}
+
+func (f *frameWriter) write(id uint64, data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return writeFrame(f.w, id, data)
+}
+
+// responseStream is the connection a request on a persistent connection is answered on, which sends what is written to it in frames
+type responseStream struct {
+	net.Conn
+
+	frames *frameWriter
+
+	id uint64
+
+	// closed when the persistent connection closes
+	closed <-chan struct{}
+}
+
+func (s *responseStream) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(len(b), written + maxFrameBytes)]
+		if err := s.frames.write(s.id, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// Read blocks until the persistent connection closes, pullers don't send anything on a request's stream after the request.
+func (s *responseStream) Read(b []byte) (int, error) {
+	<-s.closed
+	return 0, io.EOF
+}
+
+// Close leaves the persistent connection open for other requests, see end.
+func (s *responseStream) Close() error {
+	return nil
+}
+
+// end sends the empty frame that ends the answer
+func (s *responseStream) end() error {
+	return s.frames.write(s.id, nil)
+}
+
+// muxConn is a puller's persistent connection to a peer, closed once no request was sent on it for [idleTimeout]
+type muxConn struct {
+	conn net.Conn
+
+	frames *frameWriter
+
+	// writeTimeout bounds sending a request
+	writeTimeout time.Duration
+
+	idleTimeout time.Duration
+
+	mutex sync.Mutex
+
+	// streams are the requests waiting for an answer
+	streams map[uint64]*muxStream
+
+	nextID uint64
+
+	idle *time.Timer
+
+	// closed when the connection closes, [err] is why
+	closed chan struct{}
+
+	closeOnce sync.Once
+
+	err error
+}
+
+// newMuxConn returns the persistent connection [conn], answers are only read from it once readFrames runs
+func newMuxConn(conn net.Conn, idleTimeout time.Duration, writeTimeout time.Duration) *muxConn {
+	mc := &muxConn{
+		conn: conn,
+		frames: &frameWriter{w: conn},
+		writeTimeout: writeTimeout,
+		idleTimeout: idleTimeout,
+		streams: make(map[uint64]*muxStream),
+		closed: make(chan struct{}),
+	}
+	mc.idle = time.AfterFunc(idleTimeout, func() {
+		mc.close(ConnectionClosed)
+	})
+	return mc
+}
+
+// readFrames hands the frames of every answer read from [reader], which reads [mc.conn] after the responder's hello, to the request
+// waiting for it, dropping frames of requests that gave up. Returns once the connection closes.
+func (mc *muxConn) readFrames(reader *bufio.Reader) {
+	for {
+		id, data, err := readFrame(reader, maxFrameBytes)
+		if err != nil {
+			mc.close(err)
+			return
+		}
+		mc.mutex.Lock()
+		stream := mc.streams[id]
+		mc.mutex.Unlock()
+		if stream == nil {
+			continue
+		}
+		select {
+		case stream.frames <- data:
+		case <-stream.done:
+		}
+	}
+}
+
+// open sends requests on a new stream, whose answer must arrive within [readTimeout]
+func (mc *muxConn) open(readTimeout time.Duration) (*muxStream, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if mc.isClosed() {
+		return nil, mc.closedErr()
+	}
+	mc.idle.Stop()
+	stream := &muxStream{
+		mc: mc,
+		id: mc.nextID,
+		frames: make(chan []byte),
+		done: make(chan struct{}),
+		deadline: time.NewTimer(readTimeout),
+	}
+	mc.nextID++
+	mc.streams[stream.id] = stream
+	return stream, nil
+}
+
+func (mc *muxConn) isClosed() bool {
+	select {
+	case <-mc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// closedErr wraps why the connection closed in ConnectionClosed
+func (mc *muxConn) closedErr() error {
+	if errors.Is(mc.err, ConnectionClosed) {
+		return mc.err
+	}
+	return fmt.Errorf("%w %s", ConnectionClosed, mc.err)
+}
+
+func (mc *muxConn) close(err error) {
+	mc.closeOnce.Do(func() {
+		mc.err = err
+		close(mc.closed)
+		mc.idle.Stop()
+		mc.conn.Close()
+	})
+}
+
+// muxStream is one request on a muxConn and its answer
+type muxStream struct {
+	mc *muxConn
+
+	id uint64
+
+	frames chan []byte
+
+	// closed once the puller is done with the answer
+	done chan struct{}
+
+	deadline *time.Timer
+
+	pending []byte
+
+	ended bool
+}
+
+// Write sends the request [b] in a single frame, closing the connection if that fails.
+func (s *muxStream) Write(b []byte) (int, error) {
+	s.mc.frames.mutex.Lock()
+	err := s.mc.conn.SetWriteDeadline(time.Now().Add(s.mc.writeTimeout))
+	if err == nil {
+		err = writeFrame(s.mc.conn, s.id, b)
+	}
+	s.mc.frames.mutex.Unlock()
+	if err != nil {
+		s.mc.close(err)
+		return 0, s.mc.closedErr()
+	}
+	return len(b), nil
+}
+
+// Read reads the answer, returning io.EOF once it ended and ConnectionClosed if the connection closes before then.
+func (s *muxStream) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.ended {
+			return 0, io.EOF
+		}
+		select {
+		case data := <-s.frames:
+			s.pending = data
+			s.ended = len(data) == 0
+		case <-s.mc.closed:
+			return 0, s.mc.closedErr()
+		case <-s.deadline.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	read := copy(b, s.pending)
+	s.pending = s.pending[read:]
+	return read, nil
+}
+
+// Close gives up on the rest of the answer, if any.
+func (s *muxStream) Close() error {
+	s.deadline.Stop()
+	close(s.done)
+	mc := s.mc
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	delete(mc.streams, s.id)
+	if len(mc.streams) == 0 && !mc.isClosed() {
+		mc.idle.Reset(mc.idleTimeout)
+	}
+	return nil
+}
+
+// connect dials [peer] and asks to keep the connection open, pulling the database of [peer] over it if [peer] agrees and adding
+// the connection to [n.pool]. Older peers answer with their database right away and the connection is closed.
+// Returns false if dialing [peer] failed.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) connect(peer objects.NodeID) (*objects.Database, bool, error) {
+	conn, err := n.dial(peer)
+	if err != nil {
+		return nil, false, err
+	}
+	opening := n.offer()
+	opening.mux = true
+	offered, exchange, err := n.request(opening)
+	if err == nil {
+		err = writeHello(conn, offered)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, true, err
+	}
+	reader := bufio.NewReaderSize(conn, maxHelloBytes)
+	peerHello, found, err := readHello(reader)
+	if err != nil {
+		conn.Close()
+		n.metrics.deserializationFailures.Inc()
+		return nil, true, err
+	}
+	if !found || !peerHello.mux {
+		defer conn.Close()
+		peerDB, err := n.readAnswer(reader, peerHello, found, offered, exchange, peer)
+		return peerDB, true, err
+	}
+	err = n.checkAnswer(peerHello, found, exchange, peer)
+	if err == nil {
+		// every request on the connection has its own deadline, see muxConn.open
+		err = conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, true, err
+	}
+	mc, open := n.pool.put(peer, newMuxConn(conn, time.Duration(n.config.IdleTimeout), time.Duration(n.config.ReadTimeout)), reader)
+	if !open {
+		return nil, true, fmt.Errorf("%w Node is shutting down.", ConnectionClosed)
+	}
+	peerDB, err := n.pullMux(mc, peer)
+	return peerDB, true, err
+}
+
+// pullMux pulls the database of [peer] over the persistent connection [mc], closing [mc] if that fails
+func (n *engine) pullMux(mc *muxConn, peer objects.NodeID) (*objects.Database, error) {
+	stream, err := mc.open(time.Duration(n.config.ReadTimeout))
+	if err != nil {
+		n.pool.drop(peer, mc, err)
+		return nil, err
+	}
+	defer stream.Close()
+	peerDB, err := n.pull(stream, peer)
+	if err != nil {
+		n.pool.drop(peer, mc, err)
+	}
+	return peerDB, err
+}
+
+// serveMux answers the requests of a peer that asked to keep [conn] open with the hello [opening], read from [reader], see muxConn.
+// Requests are admitted like the opening hello, and the connection is closed if one isn't or once the peer sent no request for
+// longer than it keeps an idle connection open.
+func (n *engine) serveMux(conn net.Conn, reader *bufio.Reader, opening hello, certs []*x509.Certificate) {
+	exchange, err := n.admit(conn, opening, true, certs)
+	if err != nil {
+		n.logger.Warn("negotiating with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return
+	}
+	answer := hello{mux: true, cluster: n.config.Cluster}
+	if exchange != nil {
+		answer = exchange.sign(answer)
+	}
+	if err := writeHello(conn, answer); err != nil {
+		n.logger.Warn("negotiating with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+		return
+	}
+
+	closed := make(chan struct{})
+	frames := &frameWriter{w: conn}
+	semaphore := make(chan struct{}, maxConcurrentRequests)
+	var requests sync.WaitGroup
+	defer requests.Wait()
+	// unblock requests still being answered
+	defer conn.Close()
+	defer close(closed)
+
+	// the puller closes the connection first, after [config.IdleTimeout] without a request once the last one is answered
+	idleTimeout := time.Duration(n.config.IdleTimeout) + time.Duration(n.config.ReadTimeout)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(idleTimeout)); err != nil {
+			return
+		}
+		id, data, err := readFrame(reader, maxHelloBytes)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !isTimeout(err) && !errors.Is(err, net.ErrClosed) {
+				n.logger.Warn("reading request from peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+			}
+			return
+		}
+		request, found, err := readHello(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			n.logger.Warn("negotiating with peer failed", logging.PeerKey, conn.RemoteAddr().String(), logging.ErrorKey, err)
+			return
+		}
+		semaphore <- struct{}{}
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			defer func() { <-semaphore }()
+			stream := &responseStream{Conn: conn, frames: frames, id: id, closed: closed}
+			if err := n.answer(stream, request, found, certs); err != nil {
+				conn.Close()
+				return
+			}
+			stream.end()
+		}()
+	}
+}
+
+// connPool holds the persistent connection to each peer, and tracks the goroutines reading them in [wg]
+type connPool struct {
+	wg *sync.WaitGroup
+
+	mutex sync.Mutex
+
+	conns map[objects.NodeID]*muxConn
+
+	// closed once closeAll is called, connections can't be added after
+	closed bool
+}
+
+func newConnPool(wg *sync.WaitGroup) *connPool {
+	return &connPool{
+		wg: wg,
+		conns: make(map[objects.NodeID]*muxConn),
+	}
+}
+
+// get returns the connection to [peer], false if there is none or it closed
+func (p *connPool) get(peer objects.NodeID) (*muxConn, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	mc, found := p.conns[peer]
+	if found && mc.isClosed() {
+		delete(p.conns, peer)
+		return nil, false
+	}
+	return mc, found
+}
+
+// put makes [mc] the connection to [peer] and starts reading answers from [reader], see readFrames, returning the connection
+// to pull from. If another exchange opened a connection to [peer] meanwhile, [mc] is closed and that connection is returned instead.
+// Returns false, closing [mc], if the pool is closed.
+func (p *connPool) put(peer objects.NodeID, mc *muxConn, reader *bufio.Reader) (*muxConn, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		mc.close(ConnectionClosed)
+		return nil, false
+	}
+	if old, found := p.conns[peer]; found && !old.isClosed() {
+		mc.close(ConnectionClosed)
+		return old, true
+	}
+	p.conns[peer] = mc
+	// added before closeAll returns, so waiting on [p.wg] after it waits for the reader
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		mc.readFrames(reader)
+	}()
+	return mc, true
+}
+
+// drop closes the connection to [peer] because of [err], if it is [mc]
+func (p *connPool) drop(peer objects.NodeID, mc *muxConn, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conns[peer] == mc {
+		delete(p.conns, peer)
+	}
+	mc.close(err)
+}
+
+// closeAll closes every connection, and every connection put after
+func (p *connPool) closeAll() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for peer, mc := range p.conns {
+		mc.close(ConnectionClosed)
+		delete(p.conns, peer)
+	}
+}
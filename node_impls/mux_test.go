@@ -0,0 +1,256 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// muxConfig returns the config of a node on a free port at 127.0.0.1, that only gossips when the test says so
+func muxConfig(t *testing.T) *config.Config {
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	cfg.Interval = config.Duration(time.Hour)
+	return cfg
+}
+
+// openMux opens a persistent connection to [node] as a puller offering the text encoding
+func openMux(t *testing.T, node *GossipNode) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", node.nodeID.Serialize())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5 * time.Second)))
+	require.NoError(t, writeHello(conn, hello{encodings: []objects.Encoding{objects.TextEncoding}, mux: true}))
+	reader := bufio.NewReader(conn)
+	answer, found, err := readHello(reader)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, hello{mux: true}, answer)
+	return conn, reader
+}
+
+func TestNodesReuseConnectionToPeerAcrossGossipRounds(t *testing.T) {
+	for _, clusterKey := range []string{"", testClusterKey} {
+		first, second := muxConfig(t), muxConfig(t)
+		first.ClusterKey, second.ClusterKey = clusterKey, clusterKey
+		first.Compression = config.GzipCompression
+		first.CompressionThreshold = 1
+		a, b := startPeeredNodes(t, first, second)
+
+		for value := int64(6); value < 9; value++ {
+			b.UpdateValue(value)
+			a.gossip()
+
+			gossipVal, _ := a.database.GetGossipValue(b.nodeID)
+			require.Equal(t, value, gossipVal.GetValue())
+		}
+		require.Equal(t, float64(1), a.metrics.connectionsOpened.Value())
+		require.Zero(t, a.metrics.reconnects.Value())
+	}
+}
+
+func TestNodesDialPeerEveryRoundWithoutPersistentConnections(t *testing.T) {
+	cfg := muxConfig(t)
+	cfg.PersistentConnections = false
+	a, _ := startPeeredNodes(t, cfg, muxConfig(t))
+
+	a.gossip()
+	a.gossip()
+
+	require.Equal(t, float64(3), a.metrics.connectionsOpened.Value())
+	_, found := a.pool.get(a.GetPeers()[0])
+	require.False(t, found)
+}
+
+func TestNodeReconnectsToRestartedPeer(t *testing.T) {
+	peerCfg := muxConfig(t)
+	a := startTestNode(t, muxConfig(t), 4)
+	b := startTestNode(t, peerCfg, 5)
+	require.NoError(t, a.AddPeer(b.nodeID))
+
+	b.Shutdown()
+	restarted := startTestNode(t, peerCfg, 9)
+	a.gossip()
+
+	gossipVal, _ := a.database.GetGossipValue(restarted.nodeID)
+	require.Equal(t, int64(9), gossipVal.GetValue())
+	require.Equal(t, float64(2), a.metrics.connectionsOpened.Value())
+	require.Equal(t, float64(1), a.metrics.reconnects.Value())
+	require.Empty(t, a.GetBlacklist())
+}
+
+func TestNodeClosesIdleConnections(t *testing.T) {
+	cfg := muxConfig(t)
+	cfg.IdleTimeout = config.Duration(50 * time.Millisecond)
+	a := startTestNode(t, cfg, 4)
+	b := startTestNode(t, muxConfig(t), 5)
+	require.NoError(t, a.AddPeer(b.nodeID))
+	mc, found := a.pool.get(b.nodeID)
+	require.True(t, found)
+
+	require.Eventually(t, mc.isClosed, time.Second, 10 * time.Millisecond)
+	b.UpdateValue(9)
+	a.gossip()
+
+	gossipVal, _ := a.database.GetGossipValue(b.nodeID)
+	require.Equal(t, int64(9), gossipVal.GetValue())
+	require.Equal(t, float64(2), a.metrics.connectionsOpened.Value())
+}
+
+func TestNodeDialsOlderPeersEveryRound(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	older, err := objects.DeserializeNodeID(ln.Addr().String())
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// older nodes ignore the mux param and answer right away
+			bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, "GOSSIP/1 enc=text\n" + older.Serialize() + ",1664228446,7\n")
+			conn.Close()
+		}
+	}()
+	node := startTestNode(t, muxConfig(t), 4)
+
+	require.NoError(t, node.AddPeer(older))
+	node.gossip()
+
+	gossipVal, found := node.database.GetGossipValue(older)
+	require.True(t, found)
+	require.Equal(t, int64(7), gossipVal.GetValue())
+	require.Equal(t, float64(2), node.metrics.connectionsOpened.Value())
+	_, found = node.pool.get(older)
+	require.False(t, found)
+}
+
+func TestNodeAnswersEveryRequestOverPersistentConnection(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	conn, reader := openMux(t, node)
+
+	for id := uint64(0); id < 3; id++ {
+		require.NoError(t, writeFrame(conn, id, []byte("GOSSIP/1 enc=text\n")))
+	}
+	answers := make(map[uint64]string)
+	for ended := 0; ended < 3; {
+		id, data, err := readFrame(reader, maxFrameBytes)
+		require.NoError(t, err)
+		answers[id] += string(data)
+		if len(data) == 0 {
+			ended++
+		}
+	}
+
+	expected := "GOSSIP/1 enc=text\n" + node.database.Serialize()
+	require.Equal(t, map[uint64]string{0: expected, 1: expected, 2: expected}, answers)
+}
+
+func TestNodeClosesPersistentConnectionOnInvalidRequest(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	conn, reader := openMux(t, node)
+
+	require.NoError(t, writeFrame(conn, 0, []byte("GOSSIP/2 enc=text\n")))
+
+	_, _, err := readFrame(reader, maxFrameBytes)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestMuxConnReadsConcurrentAnswers(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	conn, reader := openMux(t, node)
+	require.NoError(t, conn.SetDeadline(time.Time{}))
+	mc := newMuxConn(conn, time.Minute, time.Second)
+	go mc.readFrames(reader)
+	defer mc.close(ConnectionClosed)
+
+	var wg sync.WaitGroup
+	answers := make([]string, 8)
+	for i := range answers {
+		stream, err := mc.open(5 * time.Second)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stream.Close()
+			if _, err := io.WriteString(stream, "GOSSIP/1 enc=text\n"); err != nil {
+				return
+			}
+			answer, _ := io.ReadAll(stream)
+			answers[i] = string(answer)
+		}()
+	}
+	wg.Wait()
+
+	for _, answer := range answers {
+		require.Equal(t, "GOSSIP/1 enc=text\n" + node.database.Serialize(), answer)
+	}
+	require.Empty(t, mc.streams)
+}
+
+func TestMuxStreamFailsOnceConnectionCloses(t *testing.T) {
+	node := startTestNode(t, muxConfig(t), 4)
+	conn, reader := openMux(t, node)
+	mc := newMuxConn(conn, time.Minute, time.Second)
+	go mc.readFrames(reader)
+	stream, err := mc.open(5 * time.Second)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	node.Shutdown()
+
+	_, err = io.ReadAll(stream)
+	require.ErrorIs(t, err, ConnectionClosed)
+	_, err = mc.open(time.Second)
+	require.ErrorIs(t, err, ConnectionClosed)
+}
+
+func TestConnPoolClosesConnectionsPutAfterCloseAll(t *testing.T) {
+	var wg sync.WaitGroup
+	pool := newConnPool(&wg)
+	pool.closeAll()
+	conn, peerConn := net.Pipe()
+	defer peerConn.Close()
+	mc := newMuxConn(conn, time.Minute, time.Second)
+
+	_, open := pool.put(objects.NewNodeID("127.0.0.1", "3000"), mc, bufio.NewReader(conn))
+	require.False(t, open)
+
+	require.True(t, mc.isClosed())
+	wg.Wait()
+	_, found := pool.get(objects.NewNodeID("127.0.0.1", "3000"))
+	require.False(t, found)
+}
+
+func TestConnPoolKeepsOpenConnectionToPeer(t *testing.T) {
+	var wg sync.WaitGroup
+	pool := newConnPool(&wg)
+	defer wg.Wait()
+	defer pool.closeAll()
+	peer := objects.NewNodeID("127.0.0.1", "3000")
+	first, firstPeer := net.Pipe()
+	defer firstPeer.Close()
+	second, secondPeer := net.Pipe()
+	defer secondPeer.Close()
+	open := newMuxConn(first, time.Minute, time.Second)
+	duplicate := newMuxConn(second, time.Minute, time.Second)
+
+	mc, _ := pool.put(peer, open, bufio.NewReader(first))
+	require.Equal(t, open, mc)
+	// another exchange connected to the peer meanwhile
+	mc, _ = pool.put(peer, duplicate, bufio.NewReader(second))
+
+	require.Equal(t, open, mc)
+	require.False(t, open.isClosed())
+	require.True(t, duplicate.isClosed())
+}
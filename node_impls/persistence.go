@@ -0,0 +1,79 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+	"github.com/tedim52/gossip_two/storage"
+
+	"errors"
+	"time"
+)
+
+// restoreSnapshot merges the snapshot saved in [store], if any, into [db], [peers] and [blacklist].
+// Returns the restored snapshot, or nil if there was none.
+func restoreSnapshot(store *storage.Store, db *objects.Database, peers map[objects.NodeID]struct{}, blacklist map[objects.NodeID]struct{}) (*storage.Snapshot, error) {
+	snap, found, err := store.LoadSnapshot()
+	if err != nil || !found {
+		return nil, err
+	}
+	db.Upsert(snap.Database)
+	for _, peer := range snap.Peers {
+		peers[peer] = struct{}{}
+	}
+	for _, peer := range snap.Blacklist {
+		blacklist[peer] = struct{}{}
+	}
+	return snap, nil
+}
+
+// appendWAL records the current entries of [ids] in [db] to [wal].
+func appendWAL(wal *storage.WAL, db *objects.Database, ids []objects.NodeID) error {
+	entries := make([]storage.WALEntry, 0, len(ids))
+	for _, id := range ids {
+		value, found := db.GetGossipValue(id)
+		if !found {
+			continue
+		}
+		entries = append(entries, storage.WALEntry{NodeID: id, Value: value})
+	}
+	return wal.Append(entries...)
+}
+
+// loadIdentity returns the identity stored in [store], or a new identity for this run if [store] is nil
+func loadIdentity(store *storage.Store) (objects.Identity, error) {
+	if store == nil {
+		return objects.NewIdentity()
+	}
+	return store.LoadOrCreateIdentity()
+}
+
+// moveIdentity re-publishes the value [identity] has at another NodeID under [nodeID], so peers replace the node's old entry.
+// Returns the NodeID the node moved from and true, or false if the node didn't move.
+func moveIdentity(db *objects.Database, identity objects.Identity, nodeID objects.NodeID) (objects.NodeID, bool) {
+	prevID, found := db.GetNodeIDForIdentity(identity)
+	if !found || prevID == nodeID {
+		return objects.NodeID{}, false
+	}
+	prevValue, found := db.GetGossipValue(prevID)
+	if !found {
+		return objects.NodeID{}, false
+	}
+	moved := db.SetGossipValueFrom(nodeID, objects.NewGossipValue(time.Now(), prevValue.GetValue()).WithIdentity(identity), nodeID)
+	return prevID, moved
+}
+
+// isCorruptWAL returns true if [err] only reports a truncated corrupt tail of the write-ahead log
+func isCorruptWAL(err error) bool {
+	return errors.Is(err, storage.InvalidWALRecord)
+}
+
+// newSnapshot captures [db], [peers] and [blacklist].
+// Invariant:
+// 	- the caller holds the lock guarding [peers] and [blacklist]
+func newSnapshot(db *objects.Database, peers map[objects.NodeID]struct{}, blacklist map[objects.NodeID]struct{}) *storage.Snapshot {
+	return &storage.Snapshot{
+		Database: db,
+		Peers: nodeIDSetToList(peers),
+		Blacklist: nodeIDSetToList(blacklist),
+		TakenAt: time.Now(),
+	}
+}
@@ -0,0 +1,247 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SilentStrategy = "silent"
+	GarbageStrategy = "garbage"
+	FutureStrategy = "future"
+	SlowlorisStrategy = "slowloris"
+	OversizedStrategy = "oversized"
+	StaleStrategy = "stale"
+	FloodStrategy = "flood"
+	ImpersonateStrategy = "impersonate"
+
+	// DefaultStrategy matches what BadGossipNode always did: accept connections and never answer
+	DefaultStrategy = SilentStrategy
+
+	maxGarbageBytes = 256
+	// how far past the peer's clock forged entries are timestamped
+	futureOffset = 365 * 24 * time.Hour
+	slowlorisDelay = time.Second
+	// an unterminated line well past any sane entry size
+	oversizedBytes = 16 << 20
+	oversizedChunkBytes = 64 << 10
+	floodEntries = 4096
+	// flooded entries share few IP addresses to push against the max number of ports per IP
+	floodIPs = 64
+)
+
+var (
+	InvalidStrategy = fmt.Errorf("Invalid strategy. Please provide one of '%s'.", strings.Join(StrategyNames(), "', '"))
+)
+
+// Strategy is how a BadGossipNode answers a peer pulling its database.
+type Strategy interface {
+	// Respond writes the adversarial response to [conn], a connection from a peer pulling the node's database.
+	// [conn] is closed once Respond returns, and when the node shuts down to unblock Respond.
+	Respond(conn net.Conn, ctx StrategyContext) error
+}
+
+// countingConn counts the bytes a Strategy sends
+type countingConn struct {
+	net.Conn
+
+	onWrite func(int)
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	written, err := c.Conn.Write(b)
+	c.onWrite(written)
+	return written, err
+}
+
+// StrategyContext is the state of the node a Strategy answers for.
+type StrategyContext struct {
+	NodeID objects.NodeID
+
+	Database *objects.Database
+
+	// Done is closed when the node shuts down
+	Done <-chan struct{}
+
+	// Encoding is the encoding negotiated with the peer, strategies sending well formed entries send them in it
+	Encoding objects.Encoding
+}
+
+var strategies = map[string]func() Strategy{
+	SilentStrategy: func() Strategy { return silentStrategy{} },
+	GarbageStrategy: func() Strategy { return garbageStrategy{} },
+	FutureStrategy: func() Strategy { return futureStrategy{} },
+	SlowlorisStrategy: func() Strategy { return slowlorisStrategy{} },
+	OversizedStrategy: func() Strategy { return oversizedStrategy{} },
+	StaleStrategy: func() Strategy { return &staleStrategy{} },
+	FloodStrategy: func() Strategy { return floodStrategy{} },
+	ImpersonateStrategy: func() Strategy { return impersonateStrategy{} },
+}
+
+// NewStrategy returns the built-in Strategy called [name].
+func NewStrategy(name string) (Strategy, error) {
+	newStrategy, found := strategies[strings.ToLower(name)]
+	if !found {
+		return nil, InvalidStrategy
+	}
+	return newStrategy(), nil
+}
+
+// StrategyNames returns the names of every built-in Strategy, sorted.
+func StrategyNames() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// silentStrategy accepts the connection and never sends anything, holding it open until the peer gives up
+type silentStrategy struct{}
+
+func (silentStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	_, err := io.Copy(io.Discard, conn)
+	return err
+}
+
+// garbageStrategy sends random characters that aren't a database
+type garbageStrategy struct{}
+
+func (garbageStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	garbage := make([]byte, 1 + rand.Intn(maxGarbageBytes))
+	for i := range garbage {
+		// printable ascii, newlines included so the peer reads past the first line
+		garbage[i] = byte(' ' + rand.Intn('~' - ' ' + 1))
+		if rand.Intn(16) == 0 {
+			garbage[i] = '\n'
+		}
+	}
+	_, err := conn.Write(garbage)
+	return err
+}
+
+// futureStrategy sends a correctly formatted database with an entry for a random node timestamped in the future,
+// which would never be overwritten if accepted
+type futureStrategy struct{}
+
+func (futureStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	forged := objects.NewGossipValue(time.Now().Add(futureOffset), rand.Int63n(10))
+	_, err := conn.Write(objects.EncodeDatabaseEntry(nil, ctx.Encoding, randomNodeID(), forged))
+	return err
+}
+
+// slowlorisStrategy trickles the node's database one byte at a time to hold the peer's connection open as long as possible
+type slowlorisStrategy struct{}
+
+func (slowlorisStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	encoded := ctx.Database.Encode(ctx.Encoding)
+	if len(encoded) == 0 {
+		encoded = objects.EncodeDatabaseEntry(nil, ctx.Encoding, ctx.NodeID, objects.NewGossipValue(time.Now(), 0))
+	}
+	ticker := time.NewTicker(slowlorisDelay)
+	defer ticker.Stop()
+	for i := 0; ; i = (i + 1) % len(encoded) {
+		if _, err := conn.Write(encoded[i:i + 1]); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// oversizedStrategy sends a single line far larger than any valid entry, without a newline
+type oversizedStrategy struct{}
+
+func (oversizedStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	chunk := []byte(strings.Repeat("9", oversizedChunkBytes))
+	for sent := 0; sent < oversizedBytes; sent += len(chunk) {
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleStrategy replays the first non empty database the node served, forever
+type staleStrategy struct {
+	stale *objects.Database
+
+	mutex sync.Mutex
+}
+
+func (s *staleStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	s.mutex.Lock()
+	if s.stale == nil || s.stale.Size() == 0 {
+		// copy the database, the node keeps updating it
+		s.stale, _ = objects.DeserializeDatabase(ctx.Database.Serialize())
+	}
+	stale := s.stale
+	s.mutex.Unlock()
+
+	_, err := conn.Write(stale.Encode(ctx.Encoding))
+	return err
+}
+
+// floodStrategy sends a correctly formatted database of fake NodeIDs to fill the peer's database
+type floodStrategy struct{}
+
+func (floodStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	ips := make([]objects.IPAddress, floodIPs)
+	for i := range ips {
+		ips[i] = objects.IPAddress(randomNodeID().IP)
+	}
+	var flood []byte
+	now := time.Now()
+	for i := 0; i < floodEntries; i++ {
+		id := objects.NewNodeID(string(ips[rand.Intn(floodIPs)]), string(randomNodeID().Port))
+		flood = objects.EncodeDatabaseEntry(flood, ctx.Encoding, id, objects.NewGossipValue(now, rand.Int63n(10)))
+	}
+	_, err := conn.Write(flood)
+	return err
+}
+
+// impersonateStrategy forges a newer entry with a different value for every node in its database at the peer's IP address,
+// claiming to know the peer's own value better than the peer does, and claims every other node with an identity moved to a random
+// NodeID, to have the peer drop their entries
+type impersonateStrategy struct{}
+
+func (impersonateStrategy) Respond(conn net.Conn, ctx StrategyContext) error {
+	remoteAddr, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	var forgeries []byte
+	now := time.Now()
+	for _, id := range ctx.Database.GetNodeIDs() {
+		gossipVal, _ := ctx.Database.GetGossipValue(id)
+		if string(id.IP) == remoteAddr.Addr().Unmap().String() {
+			forged := objects.NewGossipValue(now, (gossipVal.GetValue() + 1) % 10).WithIdentity(gossipVal.GetIdentity())
+			forgeries = objects.EncodeDatabaseEntry(forgeries, ctx.Encoding, id, forged)
+		} else if gossipVal.GetIdentity() != "" {
+			moved := objects.NewGossipValue(now, gossipVal.GetValue()).WithIdentity(gossipVal.GetIdentity())
+			forgeries = objects.EncodeDatabaseEntry(forgeries, ctx.Encoding, randomNodeID(), moved)
+		}
+	}
+	_, err = conn.Write(forgeries)
+	return err
+}
+
+// randomNodeID returns a NodeID at a random IPv4 address and port
+func randomNodeID() objects.NodeID {
+	ip := fmt.Sprintf("%d.%d.%d.%d", 1 + rand.Intn(223), rand.Intn(256), rand.Intn(256), 1 + rand.Intn(254))
+	return objects.NewNodeID(ip, strconv.Itoa(1024 + rand.Intn(65535 - 1024)))
+}
@@ -0,0 +1,76 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// respondTo runs [strategy] against one end of a pipe and returns everything it sent
+func respondTo(t *testing.T, strategy Strategy, db *objects.Database) string {
+	server, client := net.Pipe()
+	go func() {
+		defer server.Close()
+		strategy.Respond(server, StrategyContext{
+			NodeID: objects.NewNodeID("127.0.0.1", "8080"),
+			Database: db,
+			Done: make(chan struct{}),
+		})
+	}()
+	response, err := io.ReadAll(client)
+	require.NoError(t, err)
+	return string(response)
+}
+
+func TestNewStrategyReturnsEveryBuiltIn(t *testing.T) {
+	for _, name := range StrategyNames() {
+		strategy, err := NewStrategy(name)
+
+		require.NoError(t, err)
+		require.NotNil(t, strategy)
+	}
+}
+
+func TestNewStrategyReturnsInvalidStrategy(t *testing.T) {
+	_, err := NewStrategy("polite")
+
+	require.ErrorIs(t, err, InvalidStrategy)
+}
+
+func TestFutureStrategySendsEntryFromTheFuture(t *testing.T) {
+	strategy, _ := NewStrategy(FutureStrategy)
+
+	response := respondTo(t, strategy, objects.InitializeDatabase())
+	_, gossipVal, err := objects.DeserializeDatabaseEntry(response[:len(response) - 1])
+
+	require.NoError(t, err)
+	require.True(t, gossipVal.GetTime().After(time.Now()))
+}
+
+func TestFloodStrategySendsValidDatabase(t *testing.T) {
+	strategy, _ := NewStrategy(FloodStrategy)
+
+	response := respondTo(t, strategy, objects.InitializeDatabase())
+	db, err := objects.DeserializeDatabase(response)
+
+	require.NoError(t, err)
+	require.Greater(t, db.Size(), floodEntries / 2)
+}
+
+func TestStaleStrategyReplaysFirstDatabase(t *testing.T) {
+	strategy, _ := NewStrategy(StaleStrategy)
+	db := objects.InitializeDatabase()
+	nodeID := objects.NewNodeID("127.0.0.1", "8080")
+	db.SetGossipValue(nodeID, objects.NewGossipValue(time.Unix(1664228446, 0), 4))
+	first := respondTo(t, strategy, db)
+
+	db.SetGossipValue(nodeID, objects.NewGossipValue(time.Unix(1664228450, 0), 5))
+
+	require.Equal(t, "127.0.0.1:8080,1664228446,4\n", first)
+	require.Equal(t, first, respondTo(t, strategy, db))
+}
@@ -0,0 +1,157 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// certificates name the NodeIDs they are issued to as URI subject alternative names, ex. 'gossip://127.0.0.1:8080'
+const nodeIDURIScheme = "gossip"
+
+var (
+	InvalidCA = errors.New("Invalid CA. Please provide a PEM file with the certificate of the cluster CA.")
+	UnboundCertificate = fmt.Errorf("Certificate isn't issued to the NodeID. Certificates must name the NodeID as a '%s://<ip-address>:<port>' URI subject alternative name.", nodeIDURIScheme)
+	UnauthenticatedPeer = errors.New("Peer didn't say which NodeID it is.")
+)
+
+// clusterTLS authenticates the node to its peers, and its peers to the node, with certificates issued by the cluster CA.
+// A certificate is only accepted for the NodeIDs it names, so a member can't pose as another.
+type clusterTLS struct {
+	certificate tls.Certificate
+
+	// roots is the cluster CA
+	roots *x509.CertPool
+}
+
+// loadClusterTLS loads the certificate, key and CA files of [cfg], nil if TLS isn't configured.
+// Returns UnboundCertificate if the certificate isn't issued to [nodeID], peers would reject it.
+func loadClusterTLS(cfg *config.Config, nodeID objects.NodeID) (*clusterTLS, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(cfg.TLSCA)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, InvalidCA
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !certifiesNodeID(leaf, nodeID) {
+		return nil, fmt.Errorf("Invalid 'tls_cert' for '%s': %w", nodeID.Serialize(), UnboundCertificate)
+	}
+	return &clusterTLS{
+		certificate: certificate,
+		roots: roots,
+	}, nil
+}
+
+// serverConfig accepts peers with a certificate issued by the cluster CA.
+// Which NodeID the peer is only becomes known from its hello, see authenticate.
+func (c *clusterTLS) serverConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.certificate},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs: c.roots,
+		MinVersion: tls.VersionTLS13,
+	}
+}
+
+// client completes the TLS handshake over [conn] to [peer] within [timeout], closing [conn] if it fails.
+// The peer must present a certificate issued by the cluster CA to [peer].
+func (c *clusterTLS) client(conn net.Conn, peer objects.NodeID, timeout time.Duration) (net.Conn, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		Certificates: []tls.Certificate{c.certificate},
+		MinVersion: tls.VersionTLS13,
+		// peers are verified against their NodeID below, not against a hostname
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return c.verify(state.PeerCertificates, peer)
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// authenticate checks that a puller that connected with [certs] is the NodeID it says it is in its hello.
+// Pullers that don't send a hello can't say.
+func (c *clusterTLS) authenticate(h hello, found bool, certs []*x509.Certificate) error {
+	if !found || h.from == (objects.NodeID{}) {
+		return UnauthenticatedPeer
+	}
+	return c.verify(certs, h.from)
+}
+
+// verify checks that [certs] chain up to the cluster CA and the first is issued to [id]
+func (c *clusterTLS) verify(certs []*x509.Certificate, id objects.NodeID) error {
+	if len(certs) == 0 {
+		return UnauthenticatedPeer
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots: c.roots,
+		Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return err
+	}
+	if !certifiesNodeID(certs[0], id) {
+		return fmt.Errorf("Peer certificate for '%s': %w", id.Serialize(), UnboundCertificate)
+	}
+	return nil
+}
+
+// certifiesNodeID returns true if [cert] names [id] as a URI subject alternative name
+func certifiesNodeID(cert *x509.Certificate, id objects.NodeID) bool {
+	for _, uri := range cert.URIs {
+		if uri.Scheme != nodeIDURIScheme {
+			continue
+		}
+		certified, err := objects.DeserializeNodeID(uri.Host)
+		if err == nil && certified.Serialize() == id.Serialize() {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptTLS completes the TLS handshake of a peer that connected on [conn] within [timeout], returning the certificates it
+// presented. Returns no certificates for plaintext connections.
+func acceptTLS(conn net.Conn, timeout time.Duration) ([]*x509.Certificate, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn.ConnectionState().PeerCertificates, nil
+}
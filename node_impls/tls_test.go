@@ -0,0 +1,206 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a cluster CA that issues node certificates into a temporary directory
+type testCA struct {
+	cert *x509.Certificate
+
+	key *ecdsa.PrivateKey
+
+	// path is the PEM file of [cert]
+	path string
+
+	dir string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "gossip test CA"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.path = writePEM(t, ca.dir, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate issued to [ids] and its key, returning their PEM files
+func (ca *testCA) issue(t *testing.T, ids ...objects.NodeID) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1 << 62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{CommonName: "gossip test node"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, id := range ids {
+		template.URIs = append(template.URIs, &url.URL{Scheme: nodeIDURIScheme, Host: id.Serialize()})
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	name := serial.String()
+	return writePEM(t, ca.dir, name + ".pem", "CERTIFICATE", der), writePEM(t, ca.dir, name + "-key.pem", "PRIVATE KEY", keyDER)
+}
+
+// keyPair issues a certificate to [ids] for dialing or answering nodes directly
+func (ca *testCA) keyPair(t *testing.T, ids ...objects.NodeID) tls.Certificate {
+	certPath, keyPath := ca.issue(t, ids...)
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err)
+	return certificate
+}
+
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+// tlsConfig returns the config of a node on a free port at 127.0.0.1 with a certificate issued by [ca] to its NodeID
+func tlsConfig(t *testing.T, ca *testCA) *config.Config {
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	nodeID, err := cfg.AdvertiseNodeID()
+	require.NoError(t, err)
+	cfg.TLSCert, cfg.TLSKey = ca.issue(t, nodeID)
+	cfg.TLSCA = ca.path
+	return cfg
+}
+
+// pullTLS connects to [node] with [certificate], sends [request] and returns everything the node answered
+func pullTLS(t *testing.T, node *GossipNode, certificate tls.Certificate, request string) string {
+	conn, err := tls.Dial("tcp", node.nodeID.Serialize(), &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5 * time.Second)))
+	_, err = io.WriteString(conn, request)
+	require.NoError(t, err)
+	// the node hangs up on pullers it doesn't authenticate, which can reset the connection
+	response, _ := io.ReadAll(conn)
+	return string(response)
+}
+
+func TestNodesGossipOverMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	first := startTestNode(t, tlsConfig(t, ca), 4)
+	second := startTestNode(t, tlsConfig(t, ca), 5)
+
+	require.NoError(t, first.AddPeer(second.nodeID))
+	require.NoError(t, second.AddPeer(first.nodeID))
+
+	require.Equal(t, 2, first.database.Size())
+	require.Equal(t, first.database.Serialize(), second.database.Serialize())
+}
+
+func TestTLSNodesRejectPeersOfOtherClusters(t *testing.T) {
+	member := startTestNode(t, tlsConfig(t, newTestCA(t)), 4)
+	outsider := startTestNode(t, tlsConfig(t, newTestCA(t)), 5)
+
+	require.Error(t, outsider.AddPeer(member.nodeID))
+	require.Error(t, member.AddPeer(outsider.nodeID))
+
+	require.Equal(t, 1, member.database.Size())
+	require.Equal(t, 1, outsider.database.Size())
+	require.Positive(t, member.metrics.authenticationFailures.Value())
+}
+
+func TestTLSNodeRejectsPlaintextPuller(t *testing.T) {
+	node := startTestNode(t, tlsConfig(t, newTestCA(t)), 4)
+
+	response := pullRaw(t, node, "GOSSIP/1 enc=text\n")
+
+	require.NotContains(t, response, node.nodeID.Serialize())
+}
+
+func TestTLSNodeAuthenticatesPullerAsNodeIDInHello(t *testing.T) {
+	ca := newTestCA(t)
+	node := startTestNode(t, tlsConfig(t, ca), 4)
+	member := objects.NewNodeID("127.0.0.1", "3000")
+	certificate := ca.keyPair(t, member)
+
+	response := pullTLS(t, node, certificate, "GOSSIP/1 enc=text from=" + member.Serialize() + "\n")
+	require.Equal(t, "GOSSIP/1 enc=text\n" + node.database.Serialize(), response)
+
+	// a member can't pose as another member, or not say who it is
+	require.Empty(t, pullTLS(t, node, certificate, "GOSSIP/1 enc=text from=127.0.0.1:3001\n"))
+	require.Empty(t, pullTLS(t, node, certificate, "GOSSIP/1 enc=text\n"))
+	require.Empty(t, pullTLS(t, node, certificate, ""))
+	require.Equal(t, float64(3), node.metrics.authenticationFailures.Value())
+}
+
+func TestTLSNodeRejectsResponderWithCertificateOfAnotherNodeID(t *testing.T) {
+	ca := newTestCA(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	impostor, err := objects.DeserializeNodeID(ln.Addr().String())
+	require.NoError(t, err)
+	ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{ca.keyPair(t, objects.NewNodeID("127.0.0.1", "3000"))}})
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, impostor.Serialize() + ",1664228446,7\n")
+	}()
+	node := startTestNode(t, tlsConfig(t, ca), 4)
+
+	err = node.AddPeer(impostor)
+
+	require.ErrorIs(t, err, UnboundCertificate)
+	require.Equal(t, []objects.NodeID{impostor}, node.GetBlacklist())
+	require.Equal(t, 1, node.database.Size())
+}
+
+func TestNewNodeRejectsCertificateOfAnotherNodeID(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsConfig(t, ca)
+	cfg.TLSCert, cfg.TLSKey = ca.issue(t, objects.NewNodeID("127.0.0.1", "3000"))
+
+	_, err := NewHealthyGossipNode(cfg, logging.Discard())
+
+	require.ErrorIs(t, err, UnboundCertificate)
+}
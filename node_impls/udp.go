@@ -0,0 +1,230 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/logging"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// how long a puller waits for a peer's answer over UDP before pulling its database over TCP
+	udpTimeout = 500 * time.Millisecond
+	// how long a puller pulls over TCP right away from a peer that didn't answer over UDP, doubled every time it doesn't answer again
+	minUDPBackoff = 30 * time.Second
+	maxUDPBackoff = 30 * time.Minute
+)
+
+var (
+	NoDatagramAnswer = errors.New("Peer didn't answer over UDP.")
+)
+
+// Over UDP, the puller sends a hello with the digest of its database ('GOSSIP/1 enc=binary,text digest=<hash>') in a single datagram.
+// The peer answers with the digest of its own database in a single datagram, followed by the database itself if the digests differ
+// and the database fits in [config.MaxUDPPayload]. If it doesn't, or the peer doesn't answer, the puller pulls it over TCP.
+
+// listenUDP answers peers asking for this node's database over UDP on [pc]
+func (n *engine) listenUDP(pc net.PacketConn) {
+	defer n.wg.Done()
+	defer pc.Close()
+
+	// a request is a single hello, anything longer is cut short and rejected as an invalid hello
+	request := make([]byte, maxHelloBytes)
+	for {
+		read, addr, err := pc.ReadFrom(request)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.logger.Warn("reading datagram failed", logging.ErrorKey, err)
+			continue
+		}
+		answer, err := n.answerDatagram(request[:read])
+		if err != nil {
+			// anyone can send a datagram, so this isn't worth more than a debug log
+			n.logger.Debug("answering datagram failed", logging.PeerKey, addr.String(), logging.ErrorKey, err)
+		}
+		if answer == nil {
+			continue
+		}
+		written, err := pc.WriteTo(answer, addr)
+		n.metrics.bytesSent.Add(float64(written))
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			n.logger.Warn("sending datagram failed", logging.PeerKey, addr.String(), logging.ErrorKey, err)
+		}
+	}
+}
+
+// answerDatagram returns the datagram answering the datagram [request], nil if the peer isn't sent anything.
+// Like over TCP, peers of another cluster are only sent this node's cluster, and requests must be signed with the cluster key, which
+// [config.UDP] requires so a spoofed datagram can't have the node send its database to someone else.
+func (n *engine) answerDatagram(request []byte) ([]byte, error) {
+	peerHello, found, err := readHello(bufio.NewReader(bytes.NewReader(request)))
+	if err == nil && !found {
+		err = InvalidHello
+	}
+	if err != nil {
+		return nil, err
+	}
+	var exchange *exchangeAuth
+	if n.auth != nil {
+		if exchange, err = n.auth.verifyRequest(peerHello, found); err != nil {
+			n.metrics.authenticationFailures.Inc()
+			return nil, err
+		}
+	}
+	answer := hello{cluster: n.config.Cluster}
+	if err := checkCluster(peerHello, n.config.Cluster); err != nil {
+		n.metrics.clusterMismatches.Inc()
+		return datagram(answer, exchange, nil), err
+	}
+	answer.digest = n.database.Hash()
+	if peerHello.digest != answer.digest {
+		withDatabase := answer
+		enc := negotiateEncoding(peerHello.encodings)
+		withDatabase.encodings = []objects.Encoding{enc}
+		if d := datagram(withDatabase, exchange, n.database.Encode(enc)); len(d) <= n.config.MaxUDPPayload {
+			return d, nil
+		}
+	}
+	return datagram(answer, exchange, nil), nil
+}
+
+// datagram returns the hello [h] signed for [exchange], if any, followed by the database [payload] if [h] has an encoding
+func datagram(h hello, exchange *exchangeAuth, payload []byte) []byte {
+	if exchange != nil {
+		h = exchange.sign(h)
+	}
+	var b bytes.Buffer
+	b.WriteString(h.String())
+	if len(h.encodings) == 0 {
+		return b.Bytes()
+	}
+	if exchange == nil {
+		b.Write(payload)
+		return b.Bytes()
+	}
+	// writes to a bytes.Buffer don't fail
+	sealer := exchange.seal(&b, h)
+	sealer.Write(payload)
+	sealer.Close()
+	return b.Bytes()
+}
+
+// pullDatagram asks [peer] for its database over UDP, see listenUDP. Returns a nil database if both nodes have the same database.
+// Returns false if the database has to be pulled over TCP instead, with NoDatagramAnswer if the peer didn't answer, ex. because it
+// doesn't listen on UDP, or without an error if its database didn't fit in a datagram.
+// Invariant:
+// 	- the caller doesn't hold [n.mutex]
+func (n *engine) pullDatagram(peer objects.NodeID) (*objects.Database, bool, error) {
+	digest := n.database.Hash()
+	offered, exchange, err := n.request(hello{
+		encodings: offeredEncodings(n.config.WireEncoding()),
+		digest: digest,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := dialDatagram(peer, n.config)
+	if err != nil {
+		return nil, false, NoDatagramAnswer
+	}
+	defer conn.Close()
+	answer := make([]byte, n.config.MaxUDPPayload + 1)
+	read := 0
+	if err = conn.SetDeadline(time.Now().Add(udpTimeout)); err == nil {
+		if err = writeHello(conn, offered); err == nil {
+			read, err = conn.Read(answer)
+		}
+	}
+	// peers without UDP and older nodes don't answer or refuse the datagram
+	if err != nil {
+		return nil, false, NoDatagramAnswer
+	}
+	// peers with a larger max payload can send more than fits
+	if read > n.config.MaxUDPPayload {
+		return nil, false, nil
+	}
+	n.metrics.bytesReceived.Add(float64(read))
+
+	reader := bufio.NewReader(bytes.NewReader(answer[:read]))
+	peerHello, found, err := readHello(reader)
+	if err == nil && !found {
+		err = InvalidHello
+	}
+	if err != nil {
+		n.metrics.deserializationFailures.Inc()
+		return nil, false, err
+	}
+	if err := n.checkAnswer(peerHello, found, exchange, peer); err != nil {
+		return nil, false, err
+	}
+	if peerHello.digest == digest {
+		return nil, true, nil
+	}
+	if len(peerHello.encodings) == 0 {
+		return nil, false, nil
+	}
+	enc, err := acceptedEncoding(peerHello, found, offered.encodings)
+	if err != nil {
+		n.metrics.deserializationFailures.Inc()
+		return nil, false, err
+	}
+	var payload io.Reader = reader
+	if exchange != nil {
+		payload = exchange.open(reader, peerHello)
+	}
+	peerDB, err := n.decode(payload, enc, peer)
+	if err != nil {
+		return nil, false, err
+	}
+	return peerDB, true, nil
+}
+
+// udpBackoff remembers the peers that didn't answer over UDP, so gossip rounds with them don't wait [udpTimeout] every time.
+// A peer is asked again once its backoff expires, and forgotten once it answers.
+type udpBackoff struct {
+	mutex sync.Mutex
+
+	peers map[objects.NodeID]backoff
+}
+
+type backoff struct {
+	until time.Time
+
+	delay time.Duration
+}
+
+func newUDPBackoff() *udpBackoff {
+	return &udpBackoff{peers: make(map[objects.NodeID]backoff)}
+}
+
+// allows returns true if [peer] can be asked over UDP at [now]
+func (b *udpBackoff) allows(peer objects.NodeID, now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return !now.Before(b.peers[peer].until)
+}
+
+// failed backs off from asking [peer] over UDP, for twice as long as the last time it didn't answer
+func (b *udpBackoff) failed(peer objects.NodeID, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delay := min(2 * b.peers[peer].delay, maxUDPBackoff)
+	if delay == 0 {
+		delay = minUDPBackoff
+	}
+	b.peers[peer] = backoff{until: now.Add(delay), delay: delay}
+}
+
+func (b *udpBackoff) answered(peer objects.NodeID) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.peers, peer)
+}
@@ -0,0 +1,162 @@
+package node_impls
+
+import (
+	"github.com/tedim52/gossip_two/config"
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// udpConfig returns the config of a node on a free port at 127.0.0.1 gossiping over UDP, that only gossips when the test says so
+func udpConfig(t *testing.T) *config.Config {
+	cfg := byzantineConfig(t, "127.0.0.1", config.StrictValidation)
+	cfg.Interval = config.Duration(time.Hour)
+	cfg.UDP = true
+	cfg.ClusterKey = testClusterKey
+	return cfg
+}
+
+// startPeeredNodes starts nodes with [first] and [second] as configs, each with the other as its only peer and its database
+func startPeeredNodes(t *testing.T, first *config.Config, second *config.Config) (*GossipNode, *GossipNode) {
+	a := startTestNode(t, first, 4)
+	b := startTestNode(t, second, 5)
+	require.NoError(t, a.AddPeer(b.nodeID))
+	require.NoError(t, b.AddPeer(a.nodeID))
+	require.Equal(t, a.database.Hash(), b.database.Hash())
+	return a, b
+}
+
+func TestNodesGossipSmallDatabasesOverUDP(t *testing.T) {
+	a, b := startPeeredNodes(t, udpConfig(t), udpConfig(t))
+
+	// same databases, only the digests are exchanged
+	a.gossip()
+	require.Equal(t, float64(1), a.metrics.udpExchanges.Value())
+
+	b.UpdateValue(9)
+	a.gossip()
+
+	gossipVal, found := a.database.GetGossipValue(b.nodeID)
+	require.True(t, found)
+	require.Equal(t, int64(9), gossipVal.GetValue())
+	require.Equal(t, float64(2), a.metrics.udpExchanges.Value())
+	require.Zero(t, a.metrics.udpFallbacks.Value())
+}
+
+func TestNodesPullLargeDatabasesOverTCP(t *testing.T) {
+	responderCfg := udpConfig(t)
+	// room for the digest, not for the database
+	responderCfg.MaxUDPPayload = 128
+	a, b := startPeeredNodes(t, udpConfig(t), responderCfg)
+
+	b.UpdateValue(9)
+	a.gossip()
+
+	gossipVal, _ := a.database.GetGossipValue(b.nodeID)
+	require.Equal(t, int64(9), gossipVal.GetValue())
+	require.Equal(t, float64(1), a.metrics.udpFallbacks.Value())
+	require.Zero(t, a.metrics.udpExchanges.Value())
+}
+
+func TestNodesPullOverTCPFromPeersWithoutUDP(t *testing.T) {
+	responderCfg := udpConfig(t)
+	responderCfg.UDP = false
+	a, b := startPeeredNodes(t, udpConfig(t), responderCfg)
+
+	b.UpdateValue(9)
+	a.gossip()
+
+	gossipVal, _ := a.database.GetGossipValue(b.nodeID)
+	require.Equal(t, int64(9), gossipVal.GetValue())
+	require.Equal(t, float64(1), a.metrics.udpFallbacks.Value())
+
+	// the peer isn't asked over UDP again until its backoff expires
+	b.UpdateValue(8)
+	start := time.Now()
+	a.gossip()
+
+	require.Less(t, time.Since(start), udpTimeout)
+	gossipVal, _ = a.database.GetGossipValue(b.nodeID)
+	require.Equal(t, int64(8), gossipVal.GetValue())
+	require.Equal(t, float64(1), a.metrics.udpFallbacks.Value())
+}
+
+func TestUDPBackoffDoublesUntilPeerAnswers(t *testing.T) {
+	backoff := newUDPBackoff()
+	peer := objects.NewNodeID("127.0.0.1", "3000")
+	now := time.Now()
+	require.True(t, backoff.allows(peer, now))
+
+	backoff.failed(peer, now)
+	require.False(t, backoff.allows(peer, now.Add(minUDPBackoff - time.Second)))
+	require.True(t, backoff.allows(peer, now.Add(minUDPBackoff)))
+
+	backoff.failed(peer, now)
+	require.False(t, backoff.allows(peer, now.Add(2 * minUDPBackoff - time.Second)))
+	for i := 0; i < 10; i++ {
+		backoff.failed(peer, now)
+	}
+	require.True(t, backoff.allows(peer, now.Add(maxUDPBackoff)))
+
+	backoff.answered(peer)
+	require.True(t, backoff.allows(peer, now))
+}
+
+func TestAnswerDatagram(t *testing.T) {
+	cfg := udpConfig(t)
+	cfg.Cluster = "blue"
+	node := startTestNode(t, cfg, 4)
+	digest := node.database.Hash()
+	puller := newClusterAuth(testClusterKey)
+	// ask signs [request] and returns the node's answer to it, after verifying it, and the database that follows it, if any
+	ask := func(request hello) (hello, string, error) {
+		signed, exchange, err := puller.signRequest(request)
+		require.NoError(t, err)
+		answer, err := node.answerDatagram([]byte(signed.String()))
+		require.NotNil(t, answer)
+		reader := bufio.NewReader(bytes.NewReader(answer))
+		answerHello, found, helloErr := readHello(reader)
+		require.NoError(t, helloErr)
+		require.NoError(t, exchange.verify(answerHello, found))
+		if len(answerHello.encodings) == 0 {
+			return answerHello, "", err
+		}
+		payload, payloadErr := io.ReadAll(exchange.open(reader, answerHello))
+		require.NoError(t, payloadErr)
+		return answerHello, string(payload), err
+	}
+	text := []objects.Encoding{objects.TextEncoding}
+
+	answer, payload, err := ask(hello{encodings: text, cluster: "blue", digest: digest})
+	require.NoError(t, err)
+	require.Equal(t, "blue", answer.cluster)
+	require.Equal(t, digest, answer.digest)
+	require.Empty(t, answer.encodings)
+	require.Empty(t, payload)
+
+	answer, payload, err = ask(hello{encodings: text, cluster: "blue"})
+	require.NoError(t, err)
+	require.Equal(t, digest, answer.digest)
+	require.Equal(t, text, answer.encodings)
+	require.Equal(t, node.database.Serialize(), payload)
+
+	answer, _, err = ask(hello{encodings: text, cluster: "green"})
+	require.ErrorIs(t, err, ClusterMismatch)
+	require.Equal(t, "blue", answer.cluster)
+	require.Empty(t, answer.digest)
+
+	// requests that aren't signed, which anyone could send from a spoofed address, aren't answered
+	unsigned, err := node.answerDatagram([]byte("GOSSIP/1 enc=text cluster=blue\n"))
+	require.ErrorIs(t, err, UnauthenticatedHello)
+	require.Nil(t, unsigned)
+
+	unsigned, err = node.answerDatagram([]byte(objects.NewNodeID("127.0.0.1", "8080").Serialize() + ",1664228446,4\n"))
+	require.ErrorIs(t, err, InvalidHello)
+	require.Nil(t, unsigned)
+}
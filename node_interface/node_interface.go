@@ -1,7 +1,25 @@
 package node_interface
 
 import (
+	"github.com/tedim52/gossip_two/metrics"
 	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"errors"
+	"time"
+)
+
+const (
+	// Range of values a node can be updated to
+	MinValue = 0
+	MaxValue = 9
+
+	HealthyMode = "healthy"
+	AdverserialMode = "adverserial"
+)
+
+var (
+	PeerBlacklisted = errors.New("Error adding peer. Peer was blacklisted.")
+	PeerNotFound = errors.New("Peer not found.")
 )
 
 type GossipNode interface {
@@ -11,14 +29,68 @@ type GossipNode interface {
 	// Gossip occurs in a pull, anti-entropy fashion meaning
 	//	1. pull -> nodes will "prompt" or "query" other nodes to get their updates
 	// 	2. anti-entropy -> when a node gets "prompted" or "queried", it will send the entirety of its database back
-	BoostrapNode()
+	// Returns an error if the node can't listen on its address.
+	BoostrapNode() (error)
+
+	// Shutdown stops gossiping and listening, and waits for in flight exchanges to finish
+	Shutdown()
 
 	// AddPeer attempts to add a peer with [id] to the nodes peer list
 	// so that it will be considered for future gossip exchanges
 	AddPeer(id objects.NodeID) (error)
 
+	// RemovePeer removes the peer with [id] from the nodes peer list.
+	// Returns PeerNotFound if [id] is not a peer.
+	RemovePeer(id objects.NodeID) (error)
+
 	// UpdateValue updates the nodes current value to [val]
 	UpdateValue(val int64)
 
+	// OnUpdate has the node call [handler] with the NodeID and new value of every entry of its database whose value changes,
+	// ex. so the repl can echo them. [handler] is called from the node's goroutines and shouldn't block.
+	OnUpdate(handler func(objects.NodeID, objects.GossipValue))
+
 	GetDatabase() (*objects.Database)
-}
\ No newline at end of file
+
+	// GetPeers returns the NodeIDs of the nodes current peers
+	GetPeers() ([]objects.NodeID)
+
+	// GetBlacklist returns the NodeIDs of the peers this node refuses to gossip with
+	GetBlacklist() ([]objects.NodeID)
+
+	// GetStatus returns a snapshot of the nodes current state
+	GetStatus() (NodeStatus)
+
+	// GetMetrics returns the registry holding this node's metrics, so it can be exposed to a monitoring system
+	GetMetrics() (*metrics.Registry)
+}
+
+// NodeStatus is a point in time summary of a GossipNode
+type NodeStatus struct {
+	// NodeID is the advertised address the node is identified by
+	NodeID objects.NodeID
+
+	// Identity stays the same when the node moves to a new NodeID
+	Identity objects.Identity
+
+	// ListenAddr is the address the node binds to, which may differ from [NodeID]
+	ListenAddr string
+
+	// Mode is either HealthyMode or AdverserialMode
+	Mode string
+
+	NumPeers int
+
+	NumBlacklisted int
+
+	DatabaseSize int
+
+	// DatabaseHash is the hash of the canonical serialization of the database, equal on nodes with the same entries
+	DatabaseHash string
+
+	// StartedAt is the time BoostrapNode was called, zero if the node hasn't been started
+	StartedAt time.Time
+
+	// LastSuccessfulExchange is the time of the last successful exchange with a peer, zero if there has been none
+	LastSuccessfulExchange time.Time
+}
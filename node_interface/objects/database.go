@@ -1,6 +1,8 @@
 package objects
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"errors"
 	"strings"
@@ -11,6 +13,7 @@ import (
 const (
 	entryDelimeter = ","
 	newEntryDelimeter = "\n"
+	// default max number of NodeIDs with the same IP address in a database
 	maxNumPortsPerIP = 3
 )
 
@@ -22,6 +25,8 @@ var(
 // [GossipValue] representing the nodes most up to date information on the contents of its peer.
 // The database is serialized and deserialized based on the following format:
 //
+// Entries are serialized sorted by their serialized NodeID, so databases with the same entries always serialize to the same string.
+//
 // Format:
 //	NodeID1,GossipValue1
 //  NodeID2,GossipValue2
@@ -29,29 +34,48 @@ var(
 //
 // where NodeID format is '<ip-address>:<port>' and GossipValue format is '<timestamp>,<value'
 // An example serialized database looks like:
-// 122.116.233.149:8080,1234154131241,123\n
 // 121.104.230.38:3000,122134423,81\n
 // 121.104.230.38:3001,1221344233,85\n
+// 122.116.233.149:8080,1234154131241,123\n
 //
 // Invariants:
-// - Cannot be more than [maxNumPortsPerIP] [NodeID] entries with the same [IPAddress]
-//	- aka cannot exist connections to more than 3 ports at the same IP
+// - Cannot be more than [maxPortsPerIP] [NodeID] entries with the same [IPAddress], unless [maxPortsPerIP] is 0
+//	- aka cannot exist connections to more than 3 ports at the same IP by default
 // - There should be no [GossipValue]'s in [db] that have a [time] later than this node's current time
 // - All IPAddress' in [ipToNumPorts] are associated with at least one IPAddress in a NodeID in [db]
+// - There is at most one [NodeID] entry per non empty [Identity], a node that moves to a new NodeID replaces its old entry unless the
+//	value comes from an unauthenticated peer, see UpsertUnauthenticatedFrom
 type Database struct {
 	db map[NodeID]GossipValue
 
+	// NodeID of the entry each identity was last seen at
+	identities map[Identity]NodeID
+
+	maxPortsPerIP int
+
+	// last [historySize] values set for each NodeID, oldest first. history isn't kept if [historySize] is 0
+	history map[NodeID][]HistoryEntry
+
+	historySize int
+
 	mutex sync.RWMutex
 }
 
+// InitializeDatabase creates an empty database allowing [maxNumPortsPerIP] ports per IP address.
 func InitializeDatabase() *Database {
+	return NewDatabase(maxNumPortsPerIP)
+}
+
+// NewDatabase creates an empty database allowing [maxPortsPerIP] ports per IP address, or any number of ports if [maxPortsPerIP] is 0.
+func NewDatabase(maxPortsPerIP int) *Database {
 	return &Database{
 		db: make(map[NodeID]GossipValue),
+		identities: make(map[Identity]NodeID),
+		maxPortsPerIP: maxPortsPerIP,
+		history: make(map[NodeID][]HistoryEntry),
 	}
 }
 
-// TODO: Printing logic is actually broken. Should print everytime there's a new update. that doesn't actually happen every time with this logic.
-
 // GetGossipValue returns the GossipValue associated with [id] if a value exists along with true.
 // If no entry is found associated with [id], an empty GossipValue and false is returned.
 func (db *Database) GetGossipValue(id NodeID) (GossipValue, bool) {
@@ -69,83 +93,207 @@ func (db *Database) GetGossipValue(id NodeID) (GossipValue, bool) {
 //	find better way to do this
 
 // SetGossipValue sets [id] to [v] in the database unless the following is the case in order to abide by invariants:
-// - There are already [maxNumPortsPerIP] ports associated with the same IPAddress in [db]
+// - [id] is not in [db] and there are already [maxPortsPerIP] ports associated with the same IPAddress in [db]
 // - The time associated with [v] is past this nodes local time ("in the future")
 // - If there is already a value in the [db] associated with [id], and the timestamp of the value is after the timestamp of [v]
-// Returns true if something was updated, and false otherwise. 
-func (db *Database) SetGossipValue(id NodeID, v GossipValue) {
+// - The identity of [v] is already at another NodeID with a timestamp no earlier than the timestamp of [v]
+// If the identity of [v] was at another NodeID, the node moved to [id] and the entry at its old NodeID is removed, keeping its history.
+// Returns true if something was updated, and false otherwise. Setting [id] to the value it already has is not an update.
+func (db *Database) SetGossipValue(id NodeID, v GossipValue) bool {
+	return db.SetGossipValueFrom(id, v, NodeID{})
+}
+
+// SetGossipValueFrom is SetGossipValue for a value received from [source], which is recorded in the history of [id] if history is enabled.
+func (db *Database) SetGossipValueFrom(id NodeID, v GossipValue, source NodeID) bool {
+	return db.setGossipValue(id, v, source, true)
+}
+
+// setGossipValue is SetGossipValueFrom, setting a value whose identity is at another NodeID without its identity unless [trustMoves]
+func (db *Database) setGossipValue(id NodeID, v GossipValue, source NodeID, trustMoves bool) bool {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
 	if v.GetTime().After(time.Now()) {
-		return
+		return false
+	}
+	identity := v.GetIdentity()
+	prevID, moved := db.identities[identity]
+	moved = moved && identity != "" && prevID != id
+	if moved && !trustMoves {
+		// anyone could claim the identity to have the entry at [prevID] removed
+		v, identity, moved = v.WithIdentity(""), "", false
 	}
 	currGossipVal, found := db.db[id]
 	if found && currGossipVal.GetTime().After(v.GetTime()) {
-		return
+		return false
 	}
-	// if db.maxPortsForIP(id.IP) {
-	// 	return
-	// }
-	db.db[id] = v
-	// THIS IS BAD THIS IS A SIDE EFFECT BUT IT GETS THE JOB DONE, PRINT ONLY EXACTLY WHEN AN UPDATE OCCURS
-	// TODO: is there a more clean way to do this? maybe return updated node ids and print at the gossip or main level
-	// only print if already in db and new value
-	// additionally this doesn't always print when we want it to (on any update)
-	if found && currGossipVal.GetValue() != v.GetValue(){
-		fmt.Println(fmt.Sprintf("%s --> %s", id.Serialize(), v.GetValueString()))
+	if found && currGossipVal.Equal(v) {
+		return false
+	}
+	if moved && !v.GetTime().After(db.db[prevID].GetTime()) {
+		// the node already moved on from [id]
+		return false
+	}
+	if !found && db.maxPortsForIP(id.IP) && !(moved && prevID.IP == id.IP) {
+		return false
+	}
+	if moved {
+		// the history at [prevID] is kept, so AsOf still finds the node there before it moved
+		delete(db.db, prevID)
 	}
+	if prevIdentity := currGossipVal.GetIdentity(); found && prevIdentity != identity && db.identities[prevIdentity] == id {
+		// another node took over [id]
+		delete(db.identities, prevIdentity)
+	}
+	if identity != "" {
+		db.identities[identity] = id
+	}
+	db.db[id] = v
+	db.recordHistory(id, v, source)
+	return true
 }
 
+// Serialize returns the canonical serialization of [db], with entries sorted by NodeID.
 func (db *Database) Serialize() string {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	dbStr := ""
-	for id, _ := range db.db { 
-		dbStr = dbStr + db.serializeDatabaseEntry(id) + "\n"
+	var builder strings.Builder
+	for _, id := range db.sortedNodeIDs() {
+		builder.WriteString(db.serializeDatabaseEntry(id))
+		builder.WriteString(newEntryDelimeter)
 	}
-	return dbStr
+	return builder.String()
+}
+
+// Hash returns the hex encoded SHA-256 hash of the canonical serialization of [db].
+// Nodes with the same entries have the same hash, so comparing hashes is a cheap way to check two nodes' databases are in sync.
+func (db *Database) Hash() string {
+	hash := sha256.Sum256([]byte(db.Serialize()))
+	return hex.EncodeToString(hash[:])
+}
+
+// Equal returns true if [db] and [other] have the same entries.
+// Values are compared as serialized, so timestamps only need to match to the second.
+func (db *Database) Equal(other *Database) bool {
+	if db == other {
+		return true
+	}
+	otherEntries := other.serializedEntries()
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if len(db.db) != len(otherEntries) {
+		return false
+	}
+	for id, gossipVal := range db.db {
+		otherVal, found := otherEntries[id]
+		if !found || gossipVal.Serialize() != otherVal {
+			return false
+		}
+	}
+	return true
 }
 
 // DeserializeDatabase takes a [dbStr] representing a database and returns a Database struct. 
+// The returned database doesn't limit the number of ports per IP address, that limit is enforced when it is upserted into another database.
+// Anything after the last newline is ignored. Use a Decoder to deserialize a database from a stream within limits.
 // Returns error if the database string is an invalid format.
 func DeserializeDatabase(dbStr string) (*Database, error) {
-	db := InitializeDatabase()
-	dbEntryStrList := strings.Split(dbStr, newEntryDelimeter)
-	dbEntryStrList = dbEntryStrList[:len(dbEntryStrList) - 1]
-	for _, entryStr  := range(dbEntryStrList) {
-		entryValueStrList := strings.SplitAfterN(entryStr, entryDelimeter, 2)
-		if len(entryValueStrList) != 2 {
-			return nil, InvalidDatabaseFormat
-		}
-		nodeIDStr := entryValueStrList[0]
-		nodeIDStr = nodeIDStr[:len(nodeIDStr)-1]
-		nodeID, err := DeserializeNodeID(nodeIDStr)
-		if err != nil {
-			// could turn this into a continue to be more liberal
-			return nil, err
-		}
-		gossipValStr := entryValueStrList[1]
-		gossipVal, err := DeserializeGossipValue(gossipValStr)
-		if err != nil {
-			// could turn this into a continue to be more liberal
-			return nil, err
-		}
-		db.SetGossipValue(nodeID, gossipVal)
+	db, err := NewDecoder(strings.NewReader(dbStr), DecoderLimits{}).Decode()
+	if errors.Is(err, TruncatedEntry) {
+		return db, nil
+	}
+	if err != nil {
+		// a Decoder with SkipInvalidEntries skips invalid entries instead, as lenient validation does
+		return nil, err
 	}
 	return db, nil
 }
 
+// SerializeDatabaseEntry serializes a single database entry into the following format: 'NodeID,GossipValue'
+// ex. 122.116.233.149:8080,1234154131241,123
+func SerializeDatabaseEntry(id NodeID, v GossipValue) string {
+	return fmt.Sprintf("%v%v%v", id.Serialize(), entryDelimeter, v.Serialize())
+}
+
+// DeserializeDatabaseEntry deserializes a single database entry in the following format: 'NodeID,GossipValue'
+// Returns error if the format is incorrect.
+func DeserializeDatabaseEntry(entryStr string) (NodeID, GossipValue, error) {
+	entryValueStrList := strings.SplitAfterN(entryStr, entryDelimeter, 2)
+	if len(entryValueStrList) != 2 {
+		return NodeID{}, GossipValue{}, InvalidDatabaseFormat
+	}
+	nodeIDStr := entryValueStrList[0]
+	nodeIDStr = nodeIDStr[:len(nodeIDStr)-1]
+	nodeID, err := DeserializeNodeID(nodeIDStr)
+	if err != nil {
+		return NodeID{}, GossipValue{}, err
+	}
+	gossipValStr := entryValueStrList[1]
+	gossipVal, err := DeserializeGossipValue(gossipValStr)
+	if err != nil {
+		return NodeID{}, GossipValue{}, err
+	}
+	return nodeID, gossipVal, nil
+}
+
 // Upsert takes in a [dbToUpsert] and merges the mappings in [db] with the mappings in [db] according to the following rules:
 // If [dbToUpsert] contains a NodeID entry not in [db], add this entry to [db]
 // If [dbToUpsert] contains a NodeID entry in [db], ONLY add this entry to [db] if the timestamp associated with the GossipValue is later than 
 // the timestamp associated with GossipValue aready in [db]
-func (db *Database) Upsert(dbToUpsert *Database) {
+// Returns the NodeIDs whose entries were updated.
+func (db *Database) Upsert(dbToUpsert *Database) []NodeID {
+	return db.UpsertFrom(dbToUpsert, NodeID{})
+}
+
+// UpsertFrom is Upsert for a database received from [source], which is recorded in the history of every updated entry.
+func (db *Database) UpsertFrom(dbToUpsert *Database, source NodeID) []NodeID {
+	return db.upsert(dbToUpsert, source, true)
+}
+
+// UpsertUnauthenticatedFrom is UpsertFrom for a database received from a [source] that isn't authenticated, which could claim any
+// node moved to have its entry removed. Identities don't move: an entry whose identity is at another NodeID is set without it.
+func (db *Database) UpsertUnauthenticatedFrom(dbToUpsert *Database, source NodeID) []NodeID {
+	return db.upsert(dbToUpsert, source, false)
+}
+
+func (db *Database) upsert(dbToUpsert *Database, source NodeID, trustMoves bool) []NodeID {
+	updated := []NodeID{}
 	for _, nodeID := range dbToUpsert.GetNodeIDs() {
 		gossipVal, _ := dbToUpsert.GetGossipValue(nodeID)
-		db.SetGossipValue(nodeID, gossipVal)
+		if db.setGossipValue(nodeID, gossipVal, source, trustMoves) {
+			updated = append(updated, nodeID)
+		}
+	}
+	return updated
+}
+
+// RemoveGossipValue removes the entry for [id] and its history from [db].
+// Returns true if there was an entry to remove.
+func (db *Database) RemoveGossipValue(id NodeID) bool {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	gossipVal, found := db.db[id]
+	if !found {
+		return false
 	}
+	delete(db.db, id)
+	delete(db.history, id)
+	if identity := gossipVal.GetIdentity(); identity != "" && db.identities[identity] == id {
+		delete(db.identities, identity)
+	}
+	return true
+}
+
+// GetNodeIDForIdentity returns the NodeID the node with [identity] is at along with true, or false if [identity] isn't in [db].
+func (db *Database) GetNodeIDForIdentity(identity Identity) (NodeID, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	id, found := db.identities[identity]
+	return id, found
 }
 
 func (db *Database) Size() int {
@@ -155,38 +303,57 @@ func (db *Database) Size() int {
 	return len(db.db)
 }
 
-// Retrieves all NodeIDs mapped in [db]
+// Retrieves all NodeIDs mapped in [db], sorted by their serialized form
 func (db *Database) GetNodeIDs() []NodeID {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	nodeIDs := make([]NodeID, len(db.db))
-	i := 0
-	for nodeID, _ := range db.db {
-		nodeIDs[i] = nodeID
-		i++
+	return db.sortedNodeIDs()
+}
+
+// sortedNodeIDs returns the NodeIDs in [db] sorted by their serialized form. [db.mutex] must be held.
+func (db *Database) sortedNodeIDs() []NodeID {
+	nodeIDs := make([]NodeID, 0, len(db.db))
+	for nodeID := range db.db {
+		nodeIDs = append(nodeIDs, nodeID)
 	}
+	SortNodeIDs(nodeIDs)
 	return nodeIDs
 }
 
+// serializedEntries returns a copy of the entries in [db] with their values serialized
+func (db *Database) serializedEntries() map[NodeID]string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	entries := make(map[NodeID]string, len(db.db))
+	for id, gossipVal := range db.db {
+		entries[id] = gossipVal.Serialize()
+	}
+	return entries
+}
+
 // Serializes a single database entry into the following format: 'NodeID,GossipValue'
 // ex. 122.116.233.149:8080,1234154131241,123
 // Invariant: 
 // 	[id] must exist as an entry in [db]
 func (db *Database) serializeDatabaseEntry(id NodeID) (string)  {
 	value, _ := db.db[id]
-	return fmt.Sprintf("%v,%v", id.Serialize(), value.Serialize())
+	return SerializeDatabaseEntry(id, value)
 }
 
 // very brute force check
-// maxPortsForIP returns true if there are [maxNumPortsPerIP] ports associated with [ip] in [db]
+// maxPortsForIP returns true if there are [maxPortsPerIP] ports associated with [ip] in [db]
 func (db *Database) maxPortsForIP(ip IPAddress) bool {
+	if db.maxPortsPerIP <= 0 {
+		return false
+	}
 	numPorts := 0
 	for nodeID, _ := range db.db {
 		if nodeID.IP == ip {
 			numPorts = numPorts + 1
 		}
-		if numPorts == maxNumPortsPerIP {
+		if numPorts == db.maxPortsPerIP {
 			return true
 		}
 	}
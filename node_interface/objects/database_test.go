@@ -1,7 +1,9 @@
 package objects
 
 import (
+	"strings"
 	"testing"
+	"time"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,8 +20,6 @@ func TestSerializeDatabaseWithOneEntry(t *testing.T){
 	require.Equal(t, expectedDBStr, dbStr)	
 }
 
-// weak test -> no order enforced on the iterating of db entries
-// so nondeterministic
 func TestSerializeDatabaseWithOneMultipleEntries(t *testing.T){
 	db := InitializeDatabase()
 
@@ -39,7 +39,7 @@ func TestSerializeDatabaseWithOneMultipleEntries(t *testing.T){
 	db.SetGossipValue(nodeIDTwo, gossipValTwo)
 	db.SetGossipValue(nodeIDThree, gossipValThree)
 
-	expectedDBStr := "127.0.0.1:8080,1664228446,4\n121.104.230.38:3000,1663218247,7\n60.60.164.141:4001,1664228459,1234\n"
+	expectedDBStr := "121.104.230.38:3000,1663218247,7\n127.0.0.1:8080,1664228446,4\n60.60.164.141:4001,1664228459,1234\n"
 
 	dbStr := db.Serialize()
 
@@ -137,4 +137,220 @@ func TestUpsert(t *testing.T) {
 	db.Upsert(dbTwo)
 
 	require.Equal(t, db.Size(), 2)	
-}
\ No newline at end of file
+}
+
+func TestSetGossipValueReturnsWhetherUpdated(t *testing.T) {
+	db := InitializeDatabase()
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+
+	require.True(t, db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4)))
+	// same value again is not an update
+	require.False(t, db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4)))
+	// older value is not an update
+	timeOld, _ := stringTimeToTime("1664228440")
+	require.False(t, db.SetGossipValue(nodeID, NewGossipValue(timeOld, 5)))
+	require.True(t, db.SetGossipValue(nodeID, NewGossipValue(timeTwo, 5)))
+}
+
+func TestUpsertReturnsUpdatedNodeIDs(t *testing.T) {
+	db := InitializeDatabase()
+	dbTwo := InitializeDatabase()
+
+	nodeIDOne := NewNodeID("127.0.0.1", "8080")
+	timeOne, _ := stringTimeToTime("1664228446")
+	gossipValOne := NewGossipValue(timeOne, 4)
+
+	nodeIDTwo := NewNodeID("127.0.0.1", "3000")
+	timeTwo, _ := stringTimeToTime("1663218247")
+	gossipValTwo := NewGossipValue(timeTwo, 7)
+
+	db.SetGossipValue(nodeIDOne, gossipValOne)
+	dbTwo.SetGossipValue(nodeIDOne, gossipValOne)
+	dbTwo.SetGossipValue(nodeIDTwo, gossipValTwo)
+
+	updated := db.Upsert(dbTwo)
+
+	require.Equal(t, []NodeID{nodeIDTwo}, updated)
+}
+
+func TestDeserializeDatabaseEntry(t *testing.T) {
+	nodeID, gossipVal, err := DeserializeDatabaseEntry("127.0.0.1:8080,1664228446,4")
+
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", nodeID.Serialize())
+	require.Equal(t, "1664228446,4", gossipVal.Serialize())
+	require.Equal(t, "127.0.0.1:8080,1664228446,4", SerializeDatabaseEntry(nodeID, gossipVal))
+}
+
+func TestDeserializeDatabaseWithIPv6AndHostnameEntries(t *testing.T) {
+	dbStr := "[2001:db8::1]:8080,1664228446,4\nnode-1.example.com:3000,1663218247,7\n"
+
+	db, err := DeserializeDatabase(dbStr)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, db.Size())
+	gossipVal, found := db.GetGossipValue(NewNodeID("2001:db8::1", "8080"))
+	require.True(t, found)
+	require.Equal(t, int64(4), gossipVal.GetValue())
+}
+
+func TestSetGossipValueMovesIdentityToNewNodeID(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	oldNodeID := NewNodeID("127.0.0.1", "8080")
+	newNodeID := NewNodeID("127.0.0.1", "9090")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(oldNodeID, NewGossipValue(timeOne, 4).WithIdentity(identity))
+
+	updated := db.SetGossipValue(newNodeID, NewGossipValue(timeTwo, 4).WithIdentity(identity))
+
+	require.True(t, updated)
+	require.Equal(t, 1, db.Size())
+	_, found := db.GetGossipValue(oldNodeID)
+	require.False(t, found)
+	require.Len(t, db.GetHistory(oldNodeID), 1)
+	nodeID, found := db.GetNodeIDForIdentity(identity)
+	require.True(t, found)
+	require.Equal(t, newNodeID, nodeID)
+}
+
+func TestUpsertUnauthenticatedFromDoesNotMoveIdentity(t *testing.T) {
+	db := InitializeDatabase()
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	oldNodeID := NewNodeID("127.0.0.1", "8080")
+	newNodeID := NewNodeID("127.0.0.2", "9090")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(oldNodeID, NewGossipValue(timeOne, 4).WithIdentity(identity))
+	peerDB := InitializeDatabase()
+	peerDB.SetGossipValue(newNodeID, NewGossipValue(timeTwo, 5).WithIdentity(identity))
+
+	updated := db.UpsertUnauthenticatedFrom(peerDB, newNodeID)
+
+	require.Equal(t, []NodeID{newNodeID}, updated)
+	require.Equal(t, "127.0.0.1:8080,1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n127.0.0.2:9090,1664228450,5\n", db.Serialize())
+	nodeID, _ := db.GetNodeIDForIdentity(identity)
+	require.Equal(t, oldNodeID, nodeID)
+}
+
+func TestSetGossipValueDoesNotMoveIdentityBackToStaleNodeID(t *testing.T) {
+	db := InitializeDatabase()
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	oldNodeID := NewNodeID("127.0.0.1", "8080")
+	newNodeID := NewNodeID("127.0.0.1", "9090")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(newNodeID, NewGossipValue(timeTwo, 4).WithIdentity(identity))
+
+	updated := db.SetGossipValue(oldNodeID, NewGossipValue(timeOne, 4).WithIdentity(identity))
+
+	require.False(t, updated)
+	require.Equal(t, "127.0.0.1:9090,1664228450,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n", db.Serialize())
+}
+
+func TestSetGossipValueMovesIdentityWhenIPIsFull(t *testing.T) {
+	db := InitializeDatabase()
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(NewNodeID("127.0.0.1", "8080"), NewGossipValue(timeOne, 4).WithIdentity(identity))
+	db.SetGossipValue(NewNodeID("127.0.0.1", "8081"), NewGossipValue(timeOne, 5))
+	db.SetGossipValue(NewNodeID("127.0.0.1", "8082"), NewGossipValue(timeOne, 6))
+
+	updated := db.SetGossipValue(NewNodeID("127.0.0.1", "9090"), NewGossipValue(timeTwo, 4).WithIdentity(identity))
+
+	require.True(t, updated)
+	require.Equal(t, 3, db.Size())
+}
+
+func TestSetGossipValueReleasesIdentityOfReusedNodeID(t *testing.T) {
+	db := InitializeDatabase()
+	identityOne := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	identityTwo := Identity("1b4e28ba-2fa1-41d2-883f-0016d3cca427")
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4).WithIdentity(identityOne))
+
+	db.SetGossipValue(nodeID, NewGossipValue(timeTwo, 5).WithIdentity(identityTwo))
+
+	_, found := db.GetNodeIDForIdentity(identityOne)
+	require.False(t, found)
+	reusedBy, _ := db.GetNodeIDForIdentity(identityTwo)
+	require.Equal(t, nodeID, reusedBy)
+}
+
+func TestDeserializeDatabaseWithIdentities(t *testing.T) {
+	dbStr := "127.0.0.1:8080,1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n"
+
+	db, err := DeserializeDatabase(dbStr)
+
+	require.NoError(t, err)
+	nodeID, found := db.GetNodeIDForIdentity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	require.True(t, found)
+	require.Equal(t, NewNodeID("127.0.0.1", "8080"), nodeID)
+	require.Equal(t, dbStr, db.Serialize())
+}
+
+func TestRemoveGossipValueRemovesEntryAndIdentity(t *testing.T) {
+	db := InitializeDatabase()
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	time, _ := stringTimeToTime("1664228446")
+	db.SetGossipValue(nodeID, NewGossipValue(time, 4).WithIdentity(identity))
+
+	require.True(t, db.RemoveGossipValue(nodeID))
+	require.False(t, db.RemoveGossipValue(nodeID))
+	require.Equal(t, 0, db.Size())
+	_, found := db.GetNodeIDForIdentity(identity)
+	require.False(t, found)
+}
+
+func TestSerializeDatabaseIsIndependentOfInsertionOrder(t *testing.T) {
+	dbStr := "121.104.230.38:3000,1663218247,7\n127.0.0.1:8080,1664228446,4\n60.60.164.141:4001,1664228459,1234\n[::1]:8080,1664228450,2\n"
+	entries := strings.SplitAfter(dbStr, "\n")
+	reversed := ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		reversed += entries[i]
+	}
+
+	db, err := DeserializeDatabase(dbStr)
+	require.NoError(t, err)
+	reversedDB, err := DeserializeDatabase(reversed)
+	require.NoError(t, err)
+
+	require.Equal(t, dbStr, db.Serialize())
+	require.Equal(t, dbStr, reversedDB.Serialize())
+	require.Equal(t, db.Hash(), reversedDB.Hash())
+	require.True(t, db.Equal(reversedDB))
+}
+
+func TestDatabaseHashAndEqualDetectDifferentValues(t *testing.T) {
+	db, err := DeserializeDatabase("127.0.0.1:8080,1664228446,4\n127.0.0.1:8081,1664228446,5\n")
+	require.NoError(t, err)
+	other, err := DeserializeDatabase("127.0.0.1:8080,1664228446,4\n127.0.0.1:8081,1664228447,5\n")
+	require.NoError(t, err)
+	smaller, err := DeserializeDatabase("127.0.0.1:8080,1664228446,4\n")
+	require.NoError(t, err)
+
+	require.NotEqual(t, db.Hash(), other.Hash())
+	require.False(t, db.Equal(other))
+	require.False(t, db.Equal(smaller))
+	require.False(t, smaller.Equal(db))
+	require.True(t, db.Equal(db))
+}
+
+func TestDatabaseEqualIgnoresSubsecondTimestamps(t *testing.T) {
+	db := InitializeDatabase()
+	db.SetGossipValue(NewNodeID("127.0.0.1", "8080"), NewGossipValue(time.Unix(1664228446, 500), 4))
+
+	gossiped, err := DeserializeDatabase(db.Serialize())
+	require.NoError(t, err)
+
+	require.True(t, db.Equal(gossiped))
+	require.Equal(t, db.Hash(), gossiped.Hash())
+}
@@ -0,0 +1,282 @@
+package objects
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	decoderBufferSize = 4096
+)
+
+var (
+	EntryTooLarge = errors.New("Database entry is larger than the max entry size.")
+	TooManyEntries = errors.New("Database has more than the max number of entries.")
+	TooManyBytes = errors.New("Database is larger than the max number of bytes.")
+	TruncatedEntry = errors.New("Database ends in the middle of an entry.")
+)
+
+// DecoderLimits bound how much a Decoder reads. A limit of 0 means no limit.
+type DecoderLimits struct {
+	// MaxEntrySize is the max number of bytes in a single entry, not counting its newline or length prefix
+	MaxEntrySize int
+
+	// MaxEntries is the max number of entries, counting entries skipped as invalid
+	MaxEntries int
+
+	// MaxBytes is the max number of bytes in the whole database
+	MaxBytes int64
+}
+
+// DecodeError is an error decoding a database, along with how far decoding got before it.
+type DecodeError struct {
+	// Entries is the number of entries decoded before the error
+	Entries int
+
+	// Bytes is the number of bytes read before the error
+	Bytes int64
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s Decoded %d entries (%d bytes) before the error.", e.Err.Error(), e.Entries, e.Bytes)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EntryError is an invalid entry skipped by a Decoder that skips invalid entries.
+type EntryError struct {
+	// Line is the line number of the entry, or its position in a binary database, starting at 1
+	Line int
+
+	Err error
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e EntryError) Unwrap() error {
+	return e.Err
+}
+
+// Decoder parses an encoded database entry by entry from a stream, in the text format described on Database or the binary format
+// described on EncodeDatabaseEntry, never holding more than one entry in memory.
+type Decoder struct {
+	reader *bufio.Reader
+
+	encoding Encoding
+
+	limits DecoderLimits
+
+	// entries is the number of valid entries decoded
+	entries int
+
+	// lines is the number of entries read, valid or not
+	lines int
+
+	bytes int64
+
+	// skipInvalid skips invalid entries instead of failing, recording them in [skipped]
+	skipInvalid bool
+
+	skipped []EntryError
+
+	// err is returned by every call to Next after decoding fails
+	err error
+}
+
+// NewDecoder returns a Decoder reading a database in the text format from [r] within [limits].
+func NewDecoder(r io.Reader, limits DecoderLimits) *Decoder {
+	return NewEncodingDecoder(r, TextEncoding, limits)
+}
+
+// NewEncodingDecoder returns a Decoder reading a database in [enc] from [r] within [limits].
+func NewEncodingDecoder(r io.Reader, enc Encoding, limits DecoderLimits) *Decoder {
+	bufferSize := decoderBufferSize
+	if limits.MaxEntrySize > 0 {
+		// room for the newline
+		bufferSize = limits.MaxEntrySize + 1
+	}
+	if limits.MaxBytes > 0 {
+		// one byte past the limit is enough to tell it was exceeded
+		r = io.LimitReader(r, limits.MaxBytes + 1)
+	}
+	return &Decoder{
+		reader: bufio.NewReaderSize(r, bufferSize),
+		encoding: enc,
+		limits: limits,
+	}
+}
+
+// SkipInvalidEntries makes [d] skip entries that fail to deserialize instead of failing, so the valid entries around them
+// are still decoded. Skipped entries are returned by Skipped.
+// Entries past [limits.MaxEntrySize] and databases past the other limits still fail decoding.
+func (d *Decoder) SkipInvalidEntries() {
+	d.skipInvalid = true
+}
+
+// Skipped returns the invalid entries skipped so far, in order.
+func (d *Decoder) Skipped() []EntryError {
+	return d.skipped
+}
+
+// Next decodes the next entry. Returns io.EOF once every entry has been decoded, or a *DecodeError if decoding failed.
+// Decoding can't continue after an error.
+func (d *Decoder) Next() (NodeID, GossipValue, error) {
+	for {
+		nodeID, gossipVal, err := d.next()
+		var entryErr EntryError
+		if d.skipInvalid && errors.As(err, &entryErr) {
+			d.skipped = append(d.skipped, entryErr)
+			continue
+		}
+		if errors.As(err, &entryErr) {
+			return d.fail(entryErr)
+		}
+		return nodeID, gossipVal, err
+	}
+}
+
+// next decodes the next entry, returning an EntryError if the entry is invalid
+func (d *Decoder) next() (NodeID, GossipValue, error) {
+	if d.err != nil {
+		return NodeID{}, GossipValue{}, d.err
+	}
+	if d.limits.MaxEntries > 0 && d.lines == d.limits.MaxEntries {
+		if _, err := d.reader.Peek(1); err == io.EOF {
+			return NodeID{}, GossipValue{}, io.EOF
+		} else if err != nil {
+			return d.fail(err)
+		}
+		return d.fail(TooManyEntries)
+	}
+	readEntry, decodeEntry := d.readTextEntry, decodeTextEntry
+	if d.encoding == BinaryEncoding {
+		readEntry, decodeEntry = d.readBinaryEntry, DecodeBinaryDatabaseEntry
+	}
+	entry, err := readEntry()
+	if d.limits.MaxBytes > 0 && d.bytes > d.limits.MaxBytes {
+		return d.fail(TooManyBytes)
+	}
+	if err == io.EOF {
+		return NodeID{}, GossipValue{}, io.EOF
+	}
+	if err != nil {
+		return d.fail(err)
+	}
+	d.lines++
+	nodeID, gossipVal, err := decodeEntry(entry)
+	if err != nil {
+		return NodeID{}, GossipValue{}, EntryError{Line: d.lines, Err: err}
+	}
+	d.entries++
+	return nodeID, gossipVal, nil
+}
+
+// Decode decodes every remaining entry into a new database, which doesn't limit the number of ports per IP address.
+// On error, the database of the entries decoded before the error is returned along with a *DecodeError.
+func (d *Decoder) Decode() (*Database, error) {
+	db := NewDatabase(0)
+	for {
+		nodeID, gossipVal, err := d.Next()
+		if err == io.EOF {
+			return db, nil
+		}
+		if err != nil {
+			return db, err
+		}
+		db.SetGossipValue(nodeID, gossipVal)
+	}
+}
+
+// BytesRead returns the number of bytes decoded so far
+func (d *Decoder) BytesRead() int64 {
+	return d.bytes
+}
+
+// readTextEntry reads the next line, without its newline.
+// Returns io.EOF at the end of the database and TruncatedEntry if it ends in the middle of a line.
+func (d *Decoder) readTextEntry() ([]byte, error) {
+	line, err := d.readLine()
+	d.bytes += int64(len(line))
+	if err == io.EOF && len(line) > 0 {
+		return nil, TruncatedEntry
+	}
+	if err != nil {
+		return nil, err
+	}
+	return line[:len(line) - 1], nil
+}
+
+func decodeTextEntry(entry []byte) (NodeID, GossipValue, error) {
+	return DeserializeDatabaseEntry(string(entry))
+}
+
+// readBinaryEntry reads the next length prefixed entry, without its length prefix.
+// Returns io.EOF at the end of the database and TruncatedEntry if it ends in the middle of an entry.
+func (d *Decoder) readBinaryEntry() ([]byte, error) {
+	entryLen, err := binary.ReadUvarint(byteCounter{d})
+	if err == io.ErrUnexpectedEOF {
+		return nil, TruncatedEntry
+	}
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, InvalidBinaryFormat
+	}
+	if d.limits.MaxEntrySize > 0 && entryLen > uint64(d.limits.MaxEntrySize) {
+		return nil, EntryTooLarge
+	}
+	if d.limits.MaxBytes > 0 && entryLen > uint64(d.limits.MaxBytes - d.bytes) {
+		return nil, TooManyBytes
+	}
+	entry := make([]byte, entryLen)
+	n, err := io.ReadFull(d.reader, entry)
+	d.bytes += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, TruncatedEntry
+	}
+	return entry, err
+}
+
+// byteCounter counts the bytes of a binary entry's length prefix
+type byteCounter struct {
+	d *Decoder
+}
+
+func (c byteCounter) ReadByte() (byte, error) {
+	b, err := c.d.reader.ReadByte()
+	if err == nil {
+		c.d.bytes++
+	}
+	return b, err
+}
+
+// readLine reads up to and including the next newline, returning EntryTooLarge if the line is past [limits.MaxEntrySize]
+func (d *Decoder) readLine() ([]byte, error) {
+	if d.limits.MaxEntrySize <= 0 {
+		return d.reader.ReadBytes(byte('\n'))
+	}
+	line, err := d.reader.ReadSlice(byte('\n'))
+	if errors.Is(err, bufio.ErrBufferFull) || (err == nil && len(line) - 1 > d.limits.MaxEntrySize) {
+		return line, EntryTooLarge
+	}
+	return line, err
+}
+
+func (d *Decoder) fail(err error) (NodeID, GossipValue, error) {
+	d.err = &DecodeError{
+		Entries: d.entries,
+		Bytes: d.bytes,
+		Err: err,
+	}
+	return NodeID{}, GossipValue{}, d.err
+}
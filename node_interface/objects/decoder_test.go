@@ -0,0 +1,127 @@
+package objects
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/require"
+)
+
+const decoderTestDB = "127.0.0.1:8080,1664228446,4\n121.104.230.38:3000,1663218247,7\n60.60.164.141:4001,1664228459,1\n"
+
+func TestDecoderDecodesEntriesInOrder(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(decoderTestDB), DecoderLimits{MaxEntrySize: 64, MaxEntries: 3, MaxBytes: int64(len(decoderTestDB))})
+
+	nodeID, gossipVal, err := decoder.Next()
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", nodeID.Serialize())
+	require.Equal(t, int64(4), gossipVal.GetValue())
+	db, err := decoder.Decode()
+
+	require.NoError(t, err)
+	require.Equal(t, 2, db.Size())
+	require.Equal(t, int64(len(decoderTestDB)), decoder.BytesRead())
+	_, _, err = decoder.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestDecoderReturnsTooManyEntriesWithPartialDatabase(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(decoderTestDB), DecoderLimits{MaxEntries: 2})
+
+	db, err := decoder.Decode()
+
+	require.ErrorIs(t, err, TooManyEntries)
+	require.Equal(t, 2, db.Size())
+	var decodeErr *DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	require.Equal(t, 2, decodeErr.Entries)
+}
+
+func TestDecoderReturnsEntryTooLargeForLineWithoutNewline(t *testing.T) {
+	// a reader that never ends, the decoder must stop on its own
+	endless := io.MultiReader(strings.NewReader("127.0.0.1:8080,1664228446,4\n"), neverEnding('9'))
+	decoder := NewDecoder(endless, DecoderLimits{MaxEntrySize: 64})
+
+	db, err := decoder.Decode()
+
+	require.ErrorIs(t, err, EntryTooLarge)
+	require.Equal(t, 1, db.Size())
+	require.LessOrEqual(t, decoder.BytesRead(), int64(28 + 65))
+}
+
+func TestDecoderReturnsTooManyBytes(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(decoderTestDB), DecoderLimits{MaxBytes: 40})
+
+	db, err := decoder.Decode()
+
+	require.ErrorIs(t, err, TooManyBytes)
+	require.Equal(t, 1, db.Size())
+}
+
+func TestDecoderReturnsTruncatedEntry(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("127.0.0.1:8080,1664228446,4\n121.104.230.38:3000,16632"), DecoderLimits{})
+
+	db, err := decoder.Decode()
+
+	require.ErrorIs(t, err, TruncatedEntry)
+	require.Equal(t, 1, db.Size())
+}
+
+func TestDecoderReturnsInvalidEntryErrorAndStops(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("127.0.0.1:8080,1664228446,4\n42.42.42:3000,1663218247,7\n60.60.164.141:4001,1664228459,1\n"), DecoderLimits{})
+
+	db, err := decoder.Decode()
+	_, _, nextErr := decoder.Next()
+
+	require.ErrorIs(t, err, InvalidIPAddress)
+	require.Equal(t, 1, db.Size())
+	require.Equal(t, err, nextErr)
+}
+
+type neverEnding byte
+
+func (b neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func TestDecoderSkipsInvalidEntriesWithLineNumbers(t *testing.T) {
+	dbStr := "127.0.0.1:8080,1664228446,4\n42.42.42:3000,1663218247,7\n60.60.164.141:4001,1664228459,1\n3214oi2klc ;kr\n"
+	decoder := NewDecoder(strings.NewReader(dbStr), DecoderLimits{})
+	decoder.SkipInvalidEntries()
+
+	db, err := decoder.Decode()
+
+	require.NoError(t, err)
+	require.Equal(t, 2, db.Size())
+	skipped := decoder.Skipped()
+	require.Len(t, skipped, 2)
+	require.Equal(t, 2, skipped[0].Line)
+	require.ErrorIs(t, skipped[0], InvalidIPAddress)
+	require.Equal(t, 4, skipped[1].Line)
+	require.ErrorIs(t, skipped[1], InvalidDatabaseFormat)
+}
+
+func TestDecoderCountsSkippedEntriesTowardsMaxEntries(t *testing.T) {
+	dbStr := "garbage\ngarbage\n127.0.0.1:8080,1664228446,4\n"
+	decoder := NewDecoder(strings.NewReader(dbStr), DecoderLimits{MaxEntries: 2})
+	decoder.SkipInvalidEntries()
+
+	db, err := decoder.Decode()
+
+	require.ErrorIs(t, err, TooManyEntries)
+	require.Equal(t, 0, db.Size())
+	require.Len(t, decoder.Skipped(), 2)
+}
+
+func TestDecoderReportsLineOfInvalidEntry(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("127.0.0.1:8080,1664228446,4\ngarbage\n"), DecoderLimits{})
+
+	_, err := decoder.Decode()
+
+	var entryErr EntryError
+	require.ErrorAs(t, err, &entryErr)
+	require.Equal(t, 2, entryErr.Line)
+}
@@ -0,0 +1,242 @@
+package objects
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TextEncoding is the line based format described on Database, meant for humans and older nodes
+	TextEncoding Encoding = "text"
+	// BinaryEncoding is the compact format described on EncodeDatabaseEntry
+	BinaryEncoding Encoding = "binary"
+
+	// address kinds of a binary NodeID
+	binaryHostname = 0
+	binaryIPv4 = 4
+	binaryIPv6 = 6
+
+	binaryPortLen = 2
+	binaryIdentityLen = 16
+)
+
+var (
+	InvalidEncoding = fmt.Errorf("Invalid encoding. Please provide either '%s' or '%s'.", BinaryEncoding, TextEncoding)
+	InvalidBinaryFormat = errors.New("Invalid binary format.")
+)
+
+// Encoding is a wire format of a database.
+type Encoding string
+
+// ParseEncoding returns the Encoding called [name].
+func ParseEncoding(name string) (Encoding, error) {
+	switch enc := Encoding(strings.ToLower(name)); enc {
+	case TextEncoding, BinaryEncoding:
+		return enc, nil
+	}
+	return "", InvalidEncoding
+}
+
+// Encodings returns every Encoding, most compact first.
+func Encodings() []Encoding {
+	return []Encoding{BinaryEncoding, TextEncoding}
+}
+
+// EncodeDatabaseEntry appends the entry mapping [id] to [v] in [enc] to [b], in the text format unless [enc] is BinaryEncoding.
+//
+// A binary entry is its length as a uvarint followed by the entry:
+//	NodeID: an address kind byte, then 4 bytes for IPv4 (kind 4), 16 bytes for IPv6 (kind 6) or
+//		a uvarint length and the name for hostnames (kind 0), then the port as 2 big endian bytes
+//	GossipValue: the unix timestamp and the value as varints, then a uvarint length and the 16 bytes of the identity,
+//		or a length of 0 without an identity
+func EncodeDatabaseEntry(b []byte, enc Encoding, id NodeID, v GossipValue) []byte {
+	if enc != BinaryEncoding {
+		b = append(b, SerializeDatabaseEntry(id, v)...)
+		return append(b, newEntryDelimeter...)
+	}
+	entry := v.appendBinary(id.appendBinary(nil))
+	b = binary.AppendUvarint(b, uint64(len(entry)))
+	return append(b, entry...)
+}
+
+// DecodeBinaryDatabaseEntry decodes a single binary entry, without its length prefix.
+// Returns error if the entry isn't exactly one NodeID followed by one GossipValue.
+func DecodeBinaryDatabaseEntry(entry []byte) (NodeID, GossipValue, error) {
+	id, n, err := readBinaryNodeID(entry)
+	if err != nil {
+		return NodeID{}, GossipValue{}, err
+	}
+	v, m, err := readBinaryGossipValue(entry[n:])
+	if err != nil {
+		return NodeID{}, GossipValue{}, err
+	}
+	if n + m != len(entry) {
+		return NodeID{}, GossipValue{}, InvalidBinaryFormat
+	}
+	return id, v, nil
+}
+
+// Encode returns the canonical encoding of [db] in [enc], with entries sorted by NodeID.
+// [db] is encoded in the text format unless [enc] is BinaryEncoding.
+func (db *Database) Encode(enc Encoding) []byte {
+	if enc != BinaryEncoding {
+		return []byte(db.Serialize())
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var b []byte
+	for _, id := range db.sortedNodeIDs() {
+		b = EncodeDatabaseEntry(b, enc, id, db.db[id])
+	}
+	return b
+}
+
+// MarshalBinary encodes [id] in the binary format described on EncodeDatabaseEntry.
+func (id NodeID) MarshalBinary() ([]byte, error) {
+	return id.appendBinary(nil), nil
+}
+
+// UnmarshalBinary decodes a NodeID in the binary format described on EncodeDatabaseEntry into [id].
+func (id *NodeID) UnmarshalBinary(data []byte) error {
+	decoded, n, err := readBinaryNodeID(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return InvalidBinaryFormat
+	}
+	*id = decoded
+	return nil
+}
+
+// MarshalBinary encodes [v] in the binary format described on EncodeDatabaseEntry.
+func (v GossipValue) MarshalBinary() ([]byte, error) {
+	return v.appendBinary(nil), nil
+}
+
+// UnmarshalBinary decodes a GossipValue in the binary format described on EncodeDatabaseEntry into [v].
+func (v *GossipValue) UnmarshalBinary(data []byte) error {
+	decoded, n, err := readBinaryGossipValue(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return InvalidBinaryFormat
+	}
+	*v = decoded
+	return nil
+}
+
+// MarshalBinary encodes [db] in the binary format, see Encode.
+func (db *Database) MarshalBinary() ([]byte, error) {
+	return db.Encode(BinaryEncoding), nil
+}
+
+func (id NodeID) appendBinary(b []byte) []byte {
+	addr, err := netip.ParseAddr(string(id.IP))
+	switch {
+	case err == nil && addr.Is4():
+		b = append(b, binaryIPv4)
+		b = append(b, addr.AsSlice()...)
+	case err == nil:
+		b = append(b, binaryIPv6)
+		b = append(b, addr.AsSlice()...)
+	default:
+		b = append(b, binaryHostname)
+		b = binary.AppendUvarint(b, uint64(len(id.IP)))
+		b = append(b, id.IP...)
+	}
+	port, _ := strconv.ParseUint(string(id.Port), 10, 16)
+	return binary.BigEndian.AppendUint16(b, uint16(port))
+}
+
+// readBinaryNodeID decodes the NodeID at the start of [b], returning the number of bytes it took up
+func readBinaryNodeID(b []byte) (NodeID, int, error) {
+	if len(b) == 0 {
+		return NodeID{}, 0, InvalidBinaryFormat
+	}
+	kind, n := b[0], 1
+	var host string
+	switch kind {
+	case binaryIPv4, binaryIPv6:
+		addrLen := 16
+		if kind == binaryIPv4 {
+			addrLen = 4
+		}
+		if len(b) < n + addrLen {
+			return NodeID{}, 0, InvalidBinaryFormat
+		}
+		addr, _ := netip.AddrFromSlice(b[n:n + addrLen])
+		host = addr.String()
+		n += addrLen
+	case binaryHostname:
+		hostLen, m := binary.Uvarint(b[n:])
+		if m <= 0 || hostLen > maxHostnameLen || uint64(len(b) - n - m) < hostLen {
+			return NodeID{}, 0, InvalidBinaryFormat
+		}
+		n += m
+		host = string(b[n:n + int(hostLen)])
+		n += int(hostLen)
+	default:
+		return NodeID{}, 0, InvalidBinaryFormat
+	}
+	if len(b) < n + binaryPortLen {
+		return NodeID{}, 0, InvalidBinaryFormat
+	}
+	port := binary.BigEndian.Uint16(b[n:])
+	n += binaryPortLen
+	host, err := canonicalHost(host)
+	if err != nil {
+		return NodeID{}, 0, err
+	}
+	if port == 0 {
+		return NodeID{}, 0, InvalidPortNumber
+	}
+	return NewNodeID(host, strconv.Itoa(int(port))), n, nil
+}
+
+func (v GossipValue) appendBinary(b []byte) []byte {
+	b = binary.AppendVarint(b, v.time.Unix())
+	b = binary.AppendVarint(b, v.value)
+	identity, err := hex.DecodeString(strings.ReplaceAll(string(v.identity), "-", ""))
+	if err != nil || len(identity) != binaryIdentityLen {
+		return binary.AppendUvarint(b, 0)
+	}
+	b = binary.AppendUvarint(b, binaryIdentityLen)
+	return append(b, identity...)
+}
+
+// readBinaryGossipValue decodes the GossipValue at the start of [b], returning the number of bytes it took up
+func readBinaryGossipValue(b []byte) (GossipValue, int, error) {
+	timestamp, n := binary.Varint(b)
+	if n <= 0 {
+		return GossipValue{}, 0, InvalidBinaryFormat
+	}
+	value, m := binary.Varint(b[n:])
+	// same range as the text format
+	if m <= 0 || value < math.MinInt32 || value > math.MaxInt32 {
+		return GossipValue{}, 0, InvalidGossipValueFormat
+	}
+	n += m
+	identityLen, m := binary.Uvarint(b[n:])
+	if m <= 0 || (identityLen != 0 && identityLen != binaryIdentityLen) || uint64(len(b) - n - m) < identityLen {
+		return GossipValue{}, 0, InvalidBinaryFormat
+	}
+	n += m
+	v := NewGossipValue(time.Unix(timestamp, 0), value)
+	if identityLen == 0 {
+		return v, n, nil
+	}
+	uuid := b[n:n + binaryIdentityLen]
+	n += binaryIdentityLen
+	identity := Identity(fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]))
+	return v.WithIdentity(identity), n, nil
+}
@@ -0,0 +1,121 @@
+package objects
+
+import (
+	"bytes"
+	"time"
+	"testing"
+	"github.com/stretchr/testify/require"
+)
+
+const encodingTestDB = "121.104.230.38:3000,1663218247,7\n127.0.0.1:8080,1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n[2001:db8::1]:4001,1664228459,-12\nnode-1.example.com:8080,1664228450,3\n"
+
+func TestNodeIDBinaryRoundTrip(t *testing.T) {
+	for _, idStr := range []string{"127.0.0.1:8080", "[2001:db8::1]:65535", "node-1.example.com:1"} {
+		id, err := DeserializeNodeID(idStr)
+		require.NoError(t, err)
+
+		data, err := id.MarshalBinary()
+		require.NoError(t, err)
+		var decoded NodeID
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		require.Equal(t, id, decoded)
+		require.Equal(t, idStr, decoded.Serialize())
+	}
+}
+
+func TestNodeIDBinaryPacksIPAddresses(t *testing.T) {
+	data, _ := NewNodeID("127.0.0.1", "8080").MarshalBinary()
+	require.Equal(t, []byte{binaryIPv4, 127, 0, 0, 1, 0x1f, 0x90}, data)
+
+	data, _ = NewNodeID("::1", "8080").MarshalBinary()
+	require.Len(t, data, 1 + 16 + binaryPortLen)
+}
+
+func TestNodeIDUnmarshalBinaryRejectsInvalidNodeIDs(t *testing.T) {
+	var id NodeID
+
+	require.ErrorIs(t, id.UnmarshalBinary([]byte{binaryIPv4, 127, 0, 0}), InvalidBinaryFormat)
+	require.ErrorIs(t, id.UnmarshalBinary([]byte{binaryIPv4, 127, 0, 0, 1, 0, 0}), InvalidPortNumber)
+	require.ErrorIs(t, id.UnmarshalBinary([]byte{binaryHostname, 3, '1', '2', '3', 0x1f, 0x90}), InvalidIPAddress)
+	require.ErrorIs(t, id.UnmarshalBinary([]byte{9, 127, 0, 0, 1, 0x1f, 0x90}), InvalidBinaryFormat)
+	require.ErrorIs(t, id.UnmarshalBinary([]byte{binaryIPv4, 127, 0, 0, 1, 0x1f, 0x90, 0}), InvalidBinaryFormat)
+}
+
+func TestGossipValueBinaryRoundTrip(t *testing.T) {
+	values := []GossipValue{
+		NewGossipValue(time.Unix(1664228446, 0), 4),
+		NewGossipValue(time.Unix(0, 0), -7).WithIdentity("6ba7b810-9dad-41d1-80b4-00c04fd430c8"),
+	}
+	for _, v := range values {
+		data, err := v.MarshalBinary()
+		require.NoError(t, err)
+		var decoded GossipValue
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		require.True(t, v.Equal(decoded))
+	}
+}
+
+func TestGossipValueUnmarshalBinaryRejectsValuesOutOfRange(t *testing.T) {
+	data, _ := NewGossipValue(time.Unix(1664228446, 0), 1 << 40).MarshalBinary()
+	var decoded GossipValue
+
+	require.ErrorIs(t, decoded.UnmarshalBinary(data), InvalidGossipValueFormat)
+}
+
+func TestBinaryDecoderDecodesEncodedDatabase(t *testing.T) {
+	db, err := DeserializeDatabase(encodingTestDB)
+	require.NoError(t, err)
+	encoded := db.Encode(BinaryEncoding)
+
+	decoder := NewEncodingDecoder(bytes.NewReader(encoded), BinaryEncoding, DecoderLimits{MaxEntrySize: 64, MaxEntries: 4, MaxBytes: int64(len(encoded))})
+	decoded, err := decoder.Decode()
+
+	require.NoError(t, err)
+	require.Equal(t, encodingTestDB, decoded.Serialize())
+	require.Equal(t, int64(len(encoded)), decoder.BytesRead())
+	require.Less(t, len(encoded), len(encodingTestDB))
+}
+
+func TestBinaryDecoderReturnsTruncatedEntry(t *testing.T) {
+	db, _ := DeserializeDatabase(encodingTestDB)
+	encoded := db.Encode(BinaryEncoding)
+
+	decoded, err := NewEncodingDecoder(bytes.NewReader(encoded[:len(encoded) - 1]), BinaryEncoding, DecoderLimits{}).Decode()
+
+	require.ErrorIs(t, err, TruncatedEntry)
+	require.Equal(t, 3, decoded.Size())
+}
+
+func TestBinaryDecoderReturnsEntryTooLargeBeforeReadingEntry(t *testing.T) {
+	// a length prefix of 2^32 without the entry
+	prefix := []byte{0x80, 0x80, 0x80, 0x80, 0x10}
+
+	_, err := NewEncodingDecoder(bytes.NewReader(prefix), BinaryEncoding, DecoderLimits{MaxEntrySize: 64}).Decode()
+
+	require.ErrorIs(t, err, EntryTooLarge)
+}
+
+func TestBinaryDecoderSkipsInvalidEntries(t *testing.T) {
+	valid := EncodeDatabaseEntry(nil, BinaryEncoding, NewNodeID("127.0.0.1", "8080"), NewGossipValue(time.Unix(1664228446, 0), 4))
+	encoded := append([]byte{3, 9, 9, 9}, valid...)
+	decoder := NewEncodingDecoder(bytes.NewReader(encoded), BinaryEncoding, DecoderLimits{})
+	decoder.SkipInvalidEntries()
+
+	db, err := decoder.Decode()
+
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080,1664228446,4\n", db.Serialize())
+	require.Len(t, decoder.Skipped(), 1)
+	require.Equal(t, 1, decoder.Skipped()[0].Line)
+}
+
+func TestParseEncoding(t *testing.T) {
+	enc, err := ParseEncoding("BINARY")
+	require.NoError(t, err)
+	require.Equal(t, BinaryEncoding, enc)
+
+	_, err = ParseEncoding("protobuf")
+	require.ErrorIs(t, err, InvalidEncoding)
+}
@@ -0,0 +1,123 @@
+package objects
+
+import (
+	"fmt"
+	"time"
+)
+
+// HistoryEntry is a value a Database held for a NodeID at some point.
+type HistoryEntry struct {
+	Value GossipValue
+
+	// Source is the peer the value was received from, the NodeID of the node itself for local updates,
+	// or an empty NodeID if unknown
+	Source NodeID
+
+	// ReceivedAt is this node's local time when the value was set
+	ReceivedAt time.Time
+}
+
+// Serializes a history entry into the following format: '<timestamp>,<value> from <source>'
+// ex. 1664228446,4 from 127.0.0.1:3000
+func (e HistoryEntry) Serialize() string {
+	source := e.Source.Serialize()
+	if source == "" {
+		source = "unknown"
+	}
+	return fmt.Sprintf("%s from %s", e.Value.Serialize(), source)
+}
+
+// EnableHistory keeps the last [size] values set for each NodeID, dropping the oldest ones past that.
+// A [size] of 0 disables history and drops the history kept so far. Only values set after history is enabled are recorded.
+func (db *Database) EnableHistory(size int) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.historySize = size
+	for id, entries := range db.history {
+		if size <= 0 {
+			delete(db.history, id)
+		} else if len(entries) > size {
+			db.history[id] = append([]HistoryEntry{}, entries[len(entries) - size:]...)
+		}
+	}
+}
+
+// GetHistory returns the values recorded for [id], oldest first.
+func (db *Database) GetHistory(id NodeID) []HistoryEntry {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return append([]HistoryEntry{}, db.history[id]...)
+}
+
+// AsOf reconstructs the database as it was at [t]: for every NodeID in [db] or its history, the latest value with a timestamp no
+// later than [t]. NodeIDs whose values all came after [t], or whose older values were dropped from the bounded history, are left out.
+// Like in [db], each identity is at a single NodeID: a node that moved is only at the NodeID of its latest value as of [t].
+// The returned database doesn't limit the number of ports per IP address.
+func (db *Database) AsOf(t time.Time) *Database {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	asOf := NewDatabase(0)
+	for id := range db.history {
+		if gossipVal, found := db.valueAsOf(id, t); found {
+			asOf.db[id] = gossipVal
+		}
+	}
+	for id := range db.db {
+		if gossipVal, found := db.valueAsOf(id, t); found {
+			asOf.db[id] = gossipVal
+		}
+	}
+	for _, id := range asOf.sortedNodeIDs() {
+		identity := asOf.db[id].GetIdentity()
+		if identity == "" {
+			continue
+		}
+		prevID, found := asOf.identities[identity]
+		if found && asOf.db[prevID].GetTime().After(asOf.db[id].GetTime()) {
+			delete(asOf.db, id)
+			continue
+		}
+		if found {
+			delete(asOf.db, prevID)
+		}
+		asOf.identities[identity] = id
+	}
+	return asOf
+}
+
+// valueAsOf returns the latest value of [id] with a timestamp no later than [t], or false if there is none.
+// Invariant:
+// 	- the caller holds [db.mutex]
+func (db *Database) valueAsOf(id NodeID, t time.Time) (GossipValue, bool) {
+	if gossipVal, found := db.db[id]; found && !gossipVal.GetTime().After(t) {
+		return gossipVal, true
+	}
+	entries := db.history[id]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Value.GetTime().After(t) {
+			return entries[i].Value, true
+		}
+	}
+	return GossipValue{}, false
+}
+
+// recordHistory appends [v] to the history of [id], dropping the oldest value if the history is full.
+// Invariant:
+// 	- the caller holds [db.mutex] for writing
+func (db *Database) recordHistory(id NodeID, v GossipValue, source NodeID) {
+	if db.historySize <= 0 {
+		return
+	}
+	entries := append(db.history[id], HistoryEntry{
+		Value: v,
+		Source: source,
+		ReceivedAt: time.Now(),
+	})
+	if len(entries) > db.historySize {
+		entries = entries[len(entries) - db.historySize:]
+	}
+	db.history[id] = entries
+}
@@ -0,0 +1,138 @@
+package objects
+
+import (
+	"testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryIsNotKeptByDefault(t *testing.T) {
+	db := InitializeDatabase()
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	time, _ := stringTimeToTime("1664228446")
+
+	db.SetGossipValue(nodeID, NewGossipValue(time, 4))
+
+	require.Empty(t, db.GetHistory(nodeID))
+}
+
+func TestHistoryKeepsLastValuesWithSource(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(2)
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	peer := NewNodeID("127.0.0.1", "3000")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	timeThree, _ := stringTimeToTime("1664228459")
+
+	db.SetGossipValueFrom(nodeID, NewGossipValue(timeOne, 4), nodeID)
+	db.SetGossipValueFrom(nodeID, NewGossipValue(timeTwo, 5), peer)
+	db.SetGossipValueFrom(nodeID, NewGossipValue(timeThree, 6), peer)
+	history := db.GetHistory(nodeID)
+
+	require.Len(t, history, 2)
+	require.Equal(t, "1664228450,5 from 127.0.0.1:3000", history[0].Serialize())
+	require.Equal(t, "1664228459,6 from 127.0.0.1:3000", history[1].Serialize())
+}
+
+func TestHistoryDoesNotRecordRejectedValues(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeOld, _ := stringTimeToTime("1664228440")
+
+	db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4))
+	db.SetGossipValue(nodeID, NewGossipValue(timeOld, 5))
+	db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4))
+
+	require.Len(t, db.GetHistory(nodeID), 1)
+}
+
+func TestUpsertFromRecordsSource(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	peerDB := InitializeDatabase()
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	peer := NewNodeID("121.104.230.38", "3000")
+	time, _ := stringTimeToTime("1664228446")
+	peerDB.SetGossipValue(nodeID, NewGossipValue(time, 4))
+
+	db.UpsertFrom(peerDB, peer)
+	history := db.GetHistory(nodeID)
+
+	require.Len(t, history, 1)
+	require.Equal(t, peer, history[0].Source)
+}
+
+func TestAsOfReconstructsDatabase(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	nodeIDOne := NewNodeID("127.0.0.1", "8080")
+	nodeIDTwo := NewNodeID("127.0.0.1", "3000")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	timeThree, _ := stringTimeToTime("1664228459")
+	db.SetGossipValue(nodeIDOne, NewGossipValue(timeOne, 4))
+	db.SetGossipValue(nodeIDOne, NewGossipValue(timeThree, 6))
+	db.SetGossipValue(nodeIDTwo, NewGossipValue(timeThree, 7))
+
+	asOf := db.AsOf(timeTwo)
+
+	require.Equal(t, "127.0.0.1:8080,1664228446,4\n", asOf.Serialize())
+	require.Equal(t, 2, db.AsOf(timeThree).Size())
+	require.Equal(t, 0, db.AsOf(timeOne.Add(-1)).Size())
+}
+
+func TestAsOfKeepsIdentities(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(nodeID, NewGossipValue(timeOne, 4).WithIdentity(identity))
+	db.SetGossipValue(nodeID, NewGossipValue(timeTwo, 5).WithIdentity(identity))
+
+	asOf := db.AsOf(timeOne)
+
+	asOfID, found := asOf.GetNodeIDForIdentity(identity)
+	require.True(t, found)
+	require.Equal(t, nodeID, asOfID)
+}
+
+func TestAsOfFindsNodeAtNodeIDItMovedFrom(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(5)
+	identity := Identity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	oldNodeID := NewNodeID("127.0.0.1", "8080")
+	newNodeID := NewNodeID("127.0.0.1", "9090")
+	timeOne, _ := stringTimeToTime("1664228446")
+	timeTwo, _ := stringTimeToTime("1664228450")
+	db.SetGossipValue(oldNodeID, NewGossipValue(timeOne, 4).WithIdentity(identity))
+	db.SetGossipValue(newNodeID, NewGossipValue(timeTwo, 5).WithIdentity(identity))
+
+	beforeMove := db.AsOf(timeOne)
+	afterMove := db.AsOf(timeTwo)
+
+	require.Equal(t, "127.0.0.1:8080,1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n", beforeMove.Serialize())
+	require.Equal(t, "127.0.0.1:9090,1664228450,5,6ba7b810-9dad-41d1-80b4-00c04fd430c8\n", afterMove.Serialize())
+	movedTo, _ := afterMove.GetNodeIDForIdentity(identity)
+	require.Equal(t, newNodeID, movedTo)
+}
+
+func TestEnableHistoryShrinksExistingHistory(t *testing.T) {
+	db := InitializeDatabase()
+	db.EnableHistory(3)
+	nodeID := NewNodeID("127.0.0.1", "8080")
+	for i, timeStr := range []string{"1664228446", "1664228450", "1664228459"} {
+		time, _ := stringTimeToTime(timeStr)
+		db.SetGossipValue(nodeID, NewGossipValue(time, int64(i)))
+	}
+
+	db.EnableHistory(1)
+	require.Len(t, db.GetHistory(nodeID), 1)
+	require.Equal(t, int64(2), db.GetHistory(nodeID)[0].Value.GetValue())
+
+	db.EnableHistory(0)
+	require.Empty(t, db.GetHistory(nodeID))
+}
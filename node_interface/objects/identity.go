@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	identityLen = 36
+)
+var (
+	InvalidIdentity = errors.New("Invalid identity format. Please provide a UUID ex. '6ba7b810-9dad-41d1-80b4-00c04fd430c8'.")
+)
+
+// Identity is a node's stable identifier, a random UUID that stays the same when the node moves to a new NodeID.
+// An empty Identity means the node didn't gossip one.
+type Identity string
+
+// NewIdentity generates a random (version 4) UUID.
+func NewIdentity() (Identity, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return Identity(fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])), nil
+}
+
+func (i Identity) Serialize() string {
+	return string(i)
+}
+
+// Deserializes an Identity string in the UUID format 'xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx', lower case hex digits only
+// Returns error if format is incorrect
+func DeserializeIdentity(identityStr string) (Identity, error) {
+	if len(identityStr) != identityLen {
+		return "", InvalidIdentity
+	}
+	for i, c := range identityStr {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", InvalidIdentity
+			}
+		default:
+			if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+				return "", InvalidIdentity
+			}
+		}
+	}
+	return Identity(identityStr), nil
+}
@@ -0,0 +1,32 @@
+package objects
+
+import (
+	"testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIdentityIsValidUUID(t *testing.T) {
+	identity, err := NewIdentity()
+	require.NoError(t, err)
+
+	deserialized, err := DeserializeIdentity(identity.Serialize())
+
+	require.NoError(t, err)
+	require.Equal(t, identity, deserialized)
+	require.Equal(t, byte('4'), identity.Serialize()[14])
+}
+
+func TestNewIdentityIsRandom(t *testing.T) {
+	identityOne, _ := NewIdentity()
+	identityTwo, _ := NewIdentity()
+
+	require.NotEqual(t, identityOne, identityTwo)
+}
+
+func TestDeserializeIdentityReturnsInvalidIdentity(t *testing.T) {
+	for _, identityStr := range []string{"", "6ba7b810-9dad-41d1-80b4-00c04fd430c", "6ba7b810x9dad-41d1-80b4-00c04fd430c8", "6BA7B810-9DAD-41D1-80B4-00C04FD430C8"} {
+		_, err := DeserializeIdentity(identityStr)
+
+		require.ErrorIs(t, err, InvalidIdentity, identityStr)
+	}
+}
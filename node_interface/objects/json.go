@@ -0,0 +1,186 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// jsonGossipValue is the JSON form of a GossipValue, ex. {"timestamp": 1664228446, "value": 4, "identity": "6ba7b810-..."}.
+// Fields are pointers so missing fields can be told apart from zero values.
+type jsonGossipValue struct {
+	// Timestamp is the number of seconds after 1970 the value was set at
+	Timestamp *int64 `json:"timestamp"`
+
+	Value *int64 `json:"value"`
+
+	// Identity is the stable identity of the node, left out if the node didn't gossip one
+	Identity Identity `json:"identity,omitempty"`
+}
+
+// jsonDatabaseEntry is the JSON form of a database entry, ex. {"node_id": "127.0.0.1:8080", "timestamp": 1664228446, "value": 4}
+type jsonDatabaseEntry struct {
+	NodeID *NodeID `json:"node_id"`
+
+	jsonGossipValue
+}
+
+func (v GossipValue) toJSON() jsonGossipValue {
+	timestamp, value := v.time.Unix(), v.value
+	return jsonGossipValue{
+		Timestamp: &timestamp,
+		Value: &value,
+		Identity: v.identity,
+	}
+}
+
+// gossipValue validates [j] the same way as the text format
+func (j jsonGossipValue) gossipValue() (GossipValue, error) {
+	if j.Timestamp == nil || j.Value == nil || *j.Value < math.MinInt32 || *j.Value > math.MaxInt32 {
+		return GossipValue{}, InvalidGossipValueFormat
+	}
+	return NewGossipValue(time.Unix(*j.Timestamp, 0), *j.Value).WithIdentity(j.Identity), nil
+}
+
+// MarshalText encodes [id] as '<ip-address>:<port>', so NodeIDs are JSON strings and can be JSON object keys.
+func (id NodeID) MarshalText() ([]byte, error) {
+	return []byte(id.Serialize()), nil
+}
+
+// UnmarshalText decodes a NodeID in the format accepted by DeserializeNodeID into [id].
+func (id *NodeID) UnmarshalText(text []byte) error {
+	decoded, err := DeserializeNodeID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = decoded
+	return nil
+}
+
+func (i Identity) MarshalText() ([]byte, error) {
+	return []byte(i.Serialize()), nil
+}
+
+// UnmarshalText decodes an Identity in the format accepted by DeserializeIdentity into [i]. Empty text is an empty Identity.
+func (i *Identity) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*i = ""
+		return nil
+	}
+	decoded, err := DeserializeIdentity(string(text))
+	if err != nil {
+		return err
+	}
+	*i = decoded
+	return nil
+}
+
+// MarshalText encodes [v] in the text format, see GossipValue.Serialize.
+func (v GossipValue) MarshalText() ([]byte, error) {
+	return []byte(v.Serialize()), nil
+}
+
+// UnmarshalText decodes a GossipValue in the format accepted by DeserializeGossipValue into [v].
+func (v *GossipValue) UnmarshalText(text []byte) error {
+	decoded, err := DeserializeGossipValue(string(text))
+	if err != nil {
+		return err
+	}
+	*v = decoded
+	return nil
+}
+
+func (v GossipValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.toJSON())
+}
+
+// UnmarshalJSON decodes a GossipValue from its JSON form into [v].
+// Returns InvalidGossipValueFormat if the timestamp or value is missing or the value is out of range, and InvalidIdentity
+// if the identity isn't a UUID.
+func (v *GossipValue) UnmarshalJSON(data []byte) error {
+	var j jsonGossipValue
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	decoded, err := j.gossipValue()
+	if err != nil {
+		return err
+	}
+	*v = decoded
+	return nil
+}
+
+// MarshalText encodes [db] in the text format, see Database.Serialize.
+func (db *Database) MarshalText() ([]byte, error) {
+	return []byte(db.Serialize()), nil
+}
+
+// UnmarshalText replaces the entries of [db] with a database in the text format.
+// Entries past the max number of ports per IP address of [db] are dropped.
+// Unlike DeserializeDatabase, a database that doesn't end in a newline is an error.
+func (db *Database) UnmarshalText(text []byte) error {
+	decoded, err := NewDecoder(bytes.NewReader(text), DecoderLimits{}).Decode()
+	if err != nil {
+		return err
+	}
+	db.replace(decoded)
+	return nil
+}
+
+// MarshalJSON encodes [db] as a list of entries sorted by NodeID,
+// ex. [{"node_id": "127.0.0.1:8080", "timestamp": 1664228446, "value": 4}].
+func (db *Database) MarshalJSON() ([]byte, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	entries := []jsonDatabaseEntry{}
+	for _, id := range db.sortedNodeIDs() {
+		entries = append(entries, jsonDatabaseEntry{
+			NodeID: &id,
+			jsonGossipValue: db.db[id].toJSON(),
+		})
+	}
+	return json.Marshal(entries)
+}
+
+// UnmarshalJSON replaces the entries of [db] with a list of entries in the form written by MarshalJSON.
+// Entries are validated like entries in the text format, and a NodeID listed twice is InvalidDatabaseFormat.
+// As with DeserializeDatabase, entries from the future are dropped, and so are entries past the max number of ports per IP address of [db].
+func (db *Database) UnmarshalJSON(data []byte) error {
+	var entries []jsonDatabaseEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	decoded := NewDatabase(0)
+	for _, entry := range entries {
+		if entry.NodeID == nil {
+			return InvalidNodeID
+		}
+		if _, found := decoded.db[*entry.NodeID]; found {
+			return InvalidDatabaseFormat
+		}
+		gossipVal, err := entry.gossipValue()
+		if err != nil {
+			return err
+		}
+		decoded.SetGossipValue(*entry.NodeID, gossipVal)
+	}
+	db.replace(decoded)
+	return nil
+}
+
+// replace replaces the entries of [db] with the entries of [other], dropping the history of [db].
+// [db] keeps its own limits, entries of [other] past them are dropped like in Upsert, and a zero Database is initialized.
+func (db *Database) replace(other *Database) {
+	// the limit is only set by NewDatabase, so it doesn't need [db.mutex]
+	limited := NewDatabase(db.maxPortsPerIP)
+	limited.Upsert(other)
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.db = limited.db
+	db.identities = limited.identities
+	db.history = make(map[NodeID][]HistoryEntry)
+}
@@ -0,0 +1,121 @@
+package objects
+
+import (
+	"encoding/json"
+	"time"
+	"testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeIDJSONRoundTrip(t *testing.T) {
+	ids := map[NodeID]NodeID{NewNodeID("::1", "8080"): NewNodeID("127.0.0.1", "3000")}
+
+	data, err := json.Marshal(ids)
+	require.NoError(t, err)
+	require.Equal(t, `{"[::1]:8080":"127.0.0.1:3000"}`, string(data))
+
+	var decoded map[NodeID]NodeID
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, ids, decoded)
+}
+
+func TestNodeIDUnmarshalJSONRejectsInvalidNodeID(t *testing.T) {
+	var id NodeID
+
+	require.ErrorIs(t, json.Unmarshal([]byte(`"42.42.42:8080"`), &id), InvalidIPAddress)
+	require.ErrorIs(t, json.Unmarshal([]byte(`"127.0.0.1"`), &id), InvalidNodeID)
+}
+
+func TestGossipValueJSONRoundTrip(t *testing.T) {
+	v := NewGossipValue(time.Unix(1664228446, 0), 4).WithIdentity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"timestamp": 1664228446, "value": 4, "identity": "6ba7b810-9dad-41d1-80b4-00c04fd430c8"}`, string(data))
+
+	var decoded GossipValue
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.True(t, v.Equal(decoded))
+}
+
+func TestGossipValueUnmarshalJSONValidates(t *testing.T) {
+	var v GossipValue
+
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"value": 4}`), &v), InvalidGossipValueFormat)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"timestamp": 1664228446}`), &v), InvalidGossipValueFormat)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"timestamp": 1664228446, "value": 4294967296}`), &v), InvalidGossipValueFormat)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"timestamp": 1664228446, "value": 4, "identity": "node-1"}`), &v), InvalidIdentity)
+}
+
+func TestGossipValueTextRoundTrip(t *testing.T) {
+	v := NewGossipValue(time.Unix(1664228446, 0), 4)
+
+	text, err := v.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "1664228446,4", string(text))
+
+	var decoded GossipValue
+	require.NoError(t, decoded.UnmarshalText(text))
+	require.True(t, v.Equal(decoded))
+	require.ErrorIs(t, decoded.UnmarshalText([]byte("4")), InvalidGossipValueFormat)
+}
+
+func TestDatabaseJSONRoundTrip(t *testing.T) {
+	db, err := DeserializeDatabase(encodingTestDB)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(db)
+	require.NoError(t, err)
+	var decoded Database
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	require.Equal(t, encodingTestDB, decoded.Serialize())
+	require.True(t, db.Equal(&decoded))
+}
+
+func TestDatabaseMarshalJSONSortsEntries(t *testing.T) {
+	db, _ := DeserializeDatabase("127.0.0.1:8080,1664228446,4\n121.104.230.38:3000,1663218247,7\n")
+
+	data, err := json.Marshal(db)
+
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"node_id": "121.104.230.38:3000", "timestamp": 1663218247, "value": 7},
+		{"node_id": "127.0.0.1:8080", "timestamp": 1664228446, "value": 4}
+	]`, string(data))
+	data, err = json.Marshal(InitializeDatabase())
+	require.NoError(t, err)
+	require.Equal(t, "[]", string(data))
+}
+
+func TestDatabaseUnmarshalJSONValidates(t *testing.T) {
+	var db Database
+
+	require.ErrorIs(t, json.Unmarshal([]byte(`[{"timestamp": 1664228446, "value": 4}]`), &db), InvalidNodeID)
+	require.ErrorIs(t, json.Unmarshal([]byte(`[{"node_id": "127.0.0.1:0", "timestamp": 1664228446, "value": 4}]`), &db), InvalidPortNumber)
+	require.ErrorIs(t, json.Unmarshal([]byte(`[{"node_id": "127.0.0.1:8080", "value": 4}]`), &db), InvalidGossipValueFormat)
+	duplicate := `[{"node_id": "127.0.0.1:8080", "timestamp": 1664228446, "value": 4}, {"node_id": "127.0.0.1:8080", "timestamp": 1664228447, "value": 5}]`
+	require.ErrorIs(t, json.Unmarshal([]byte(duplicate), &db), InvalidDatabaseFormat)
+	require.Equal(t, 0, db.Size())
+}
+
+func TestDatabaseUnmarshalJSONKeepsMaxPortsPerIP(t *testing.T) {
+	db := NewDatabase(2)
+	data := `[{"node_id": "127.0.0.1:8080", "timestamp": 1664228446, "value": 4}, {"node_id": "127.0.0.1:8081", "timestamp": 1664228446, "value": 5}, {"node_id": "127.0.0.1:8082", "timestamp": 1664228446, "value": 6}]`
+
+	require.NoError(t, json.Unmarshal([]byte(data), db))
+
+	require.Equal(t, "127.0.0.1:8080,1664228446,4\n127.0.0.1:8081,1664228446,5\n", db.Serialize())
+}
+
+func TestDatabaseTextRoundTrip(t *testing.T) {
+	db, _ := DeserializeDatabase(encodingTestDB)
+
+	text, err := db.MarshalText()
+	require.NoError(t, err)
+	decoded := InitializeDatabase()
+	require.NoError(t, decoded.UnmarshalText(text))
+
+	require.True(t, db.Equal(decoded))
+	require.ErrorIs(t, decoded.UnmarshalText([]byte("127.0.0.1:8080,1664228446,4")), TruncatedEntry)
+}
@@ -1,26 +1,27 @@
 package objects
 
 import (
-	"fmt"
 	"errors"
-	"regexp"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
-	nodeIDDelimeter = ":"
-	portRegexStr = "^((6553[0-5])|(655[0-2][0-9])|(65[0-4][0-9]{2})|(6[0-4][0-9]{3})|([1-5][0-9]{4})|([0-5]{0,5})|([0-9]{1,4}))$"
-	ipAddressRegexStr = "^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5]).){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])$"
+	maxHostnameLen = 253
+	maxHostnameLabelLen = 63
+	hostnameLabelDelimeter = "."
 )
 var (
-	ipAddressRegexPat = regexp.MustCompile(ipAddressRegexStr)
-	portRegexPat = regexp.MustCompile(portRegexStr)
-
-	InvalidIPAddress = errors.New("Invalid IP adderss format. Please provide a valid IPv4 or IPv6 address.")
+	InvalidIPAddress = errors.New("Invalid IP adderss format. Please provide a valid IPv4 address, IPv6 address or hostname.")
 	InvalidPortNumber = errors.New("Invalid TCP port format. Please provide a valid TCP port.")
-	InvalidNodeID = errors.New("Invalid node id format. Please provide a node id in the following format '<ip-address>:<port>'")
+	InvalidNodeID = errors.New("Invalid node id format. Please provide a node id in the following format '<ip-address>:<port>', with IPv6 addresses in brackets ex. '[::1]:8080'")
 )
 
+// IPAddress is the host part of a NodeID: an IPv4 address, an IPv6 address (without brackets) or a DNS hostname.
+// Hostnames are resolved when dialing the node.
 type IPAddress string
 
 type Port string
@@ -28,19 +29,19 @@ type Port string
 type NodeID struct {
 	IP IPAddress
 
-	Port Port 
-	
+	Port Port
+
 	NodeID string
 }
 
 // Creates a NodeID representation
 // Invariants:
-// 	- [ip] and [port] must have correct corresponding formats, according to regexes
+// 	- [ip] and [port] must have correct corresponding formats, use DeserializeNodeID to validate untrusted input
 func NewNodeID(ip string, port string) NodeID {
 	return NodeID{
 		IP: IPAddress(ip),
 		Port: Port(port),
-		NodeID: fmt.Sprintf("%s:%s", string(ip), string(port)),
+		NodeID: net.JoinHostPort(ip, port),
 	}
 }
 
@@ -48,20 +49,80 @@ func (id NodeID) Serialize() string {
 	return id.NodeID
 }
 
-// Deserializes a NodeID string in the following format '<ip-address>:<port>'
+// IsHostname returns true if [id] names its node by DNS hostname rather than by IP address.
+func (id NodeID) IsHostname() bool {
+	_, err := netip.ParseAddr(string(id.IP))
+	return err != nil
+}
+
+// SortNodeIDs sorts [ids] by their serialized form, the canonical order of NodeIDs.
+func SortNodeIDs(ids []NodeID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Serialize() < ids[j].Serialize()
+	})
+}
+
+// Deserializes a NodeID string in the following format '<ip-address>:<port>', where IPv6 addresses are in brackets
+// ex. '127.0.0.1:8080', '[::1]:8080' or 'node-1.example.com:8080'.
+// IP addresses are canonicalized (ex. '[0:0::1]:8080' becomes '[::1]:8080') so every node agrees on the NodeID of an address.
 // Returns error if format is incorrect
 func DeserializeNodeID(idStr string) (NodeID, error) {
-	nodeIDStrList := strings.Split(idStr, nodeIDDelimeter)
-	if len(nodeIDStrList) == 1 || len(nodeIDStrList) > 2  {
+	host, port, err := net.SplitHostPort(idStr)
+	if err != nil {
 		return NodeID{}, InvalidNodeID
 	}
-	ipAddresss := nodeIDStrList[0]
-	port := nodeIDStrList[1]
-	if !ipAddressRegexPat.Match([]byte(ipAddresss)) {
-		return NodeID{}, InvalidIPAddress
+	host, err = canonicalHost(host)
+	if err != nil {
+		return NodeID{}, err
+	}
+	port, err = canonicalPort(port)
+	if err != nil {
+		return NodeID{}, err
+	}
+	return NewNodeID(host, port), nil
+}
+
+// canonicalHost returns the canonical form of an IP address or hostname
+func canonicalHost(host string) (string, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String(), nil
+	}
+	hostname := strings.ToLower(strings.TrimSuffix(host, hostnameLabelDelimeter))
+	if !isValidHostname(hostname) {
+		return "", InvalidIPAddress
+	}
+	return hostname, nil
+}
+
+// canonicalPort returns [port] without leading zeros, rejecting port 0 since a node can't be dialed on it
+func canonicalPort(port string) (string, error) {
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || portNum == 0 {
+		return "", InvalidPortNumber
+	}
+	return strconv.FormatUint(portNum, 10), nil
+}
+
+// isValidHostname checks [hostname] against RFC 1123. The last label can't be all digits so malformed IPv4 addresses
+// like '42.42.42' aren't mistaken for hostnames.
+func isValidHostname(hostname string) bool {
+	if len(hostname) == 0 || len(hostname) > maxHostnameLen {
+		return false
 	}
-	if !portRegexPat.Match([]byte(port)) {
-		return NodeID{}, InvalidPortNumber
+	labels := strings.Split(hostname, hostnameLabelDelimeter)
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > maxHostnameLabelLen {
+			return false
+		}
+		if label[0] == '-' || label[len(label) - 1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+				return false
+			}
+		}
 	}
-	return NewNodeID(ipAddresss, port), nil
+	_, err := strconv.ParseUint(labels[len(labels) - 1], 10, 64)
+	return err != nil
 }
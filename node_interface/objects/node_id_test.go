@@ -45,4 +45,56 @@ func TestDeserializeNodeIDReturnsInvalidIPError(t *testing.T) {
 	_, err := DeserializeNodeID(invalidIPNodeIDStr)
 
 	require.Error(t, err, InvalidIPAddress)
-}
\ No newline at end of file
+}
+
+func TestDeserializeNodeIDReturnsIPv6NodeID(t *testing.T) {
+	nodeID, err := DeserializeNodeID("[2001:db8::1]:8080")
+
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1", string(nodeID.IP))
+	require.Equal(t, "8080", string(nodeID.Port))
+	require.Equal(t, "[2001:db8::1]:8080", nodeID.Serialize())
+	require.False(t, nodeID.IsHostname())
+}
+
+func TestDeserializeNodeIDCanonicalizesAddress(t *testing.T) {
+	nodeID, err := DeserializeNodeID("[0:0:0::1]:08080")
+	require.NoError(t, err)
+	require.Equal(t, "[::1]:8080", nodeID.Serialize())
+
+	mappedNodeID, err := DeserializeNodeID("[::ffff:127.0.0.1]:8080")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", mappedNodeID.Serialize())
+}
+
+func TestDeserializeNodeIDReturnsHostnameNodeID(t *testing.T) {
+	nodeID, err := DeserializeNodeID("Node-1.Example.com.:8080")
+
+	require.NoError(t, err)
+	require.Equal(t, "node-1.example.com:8080", nodeID.Serialize())
+	require.True(t, nodeID.IsHostname())
+}
+
+func TestDeserializeNodeIDReturnsInvalidNodeIDForUnbracketedIPv6(t *testing.T) {
+	_, err := DeserializeNodeID("2001:db8::1:8080")
+
+	require.ErrorIs(t, err, InvalidNodeID)
+}
+
+func TestDeserializeNodeIDReturnsInvalidIPForInvalidHostname(t *testing.T) {
+	for _, host := range []string{"-node.example.com", "node_1.example.com", "node..example.com", "127.0.0.256"} {
+		_, err := DeserializeNodeID(host + ":8080")
+
+		require.ErrorIs(t, err, InvalidIPAddress, host)
+	}
+}
+
+func TestDeserializeNodeIDReturnsInvalidPortForPortZero(t *testing.T) {
+	_, err := DeserializeNodeID("127.0.0.1:0")
+
+	require.ErrorIs(t, err, InvalidPortNumber)
+}
+
+func TestNewNodeIDBracketsIPv6(t *testing.T) {
+	require.Equal(t, "[::1]:8080", NewNodeID("::1", "8080").Serialize())
+}
@@ -19,6 +19,9 @@ type GossipValue struct {
 	time time.Time
 	
 	value int64
+
+	// identity of the node the value belongs to, empty if the node didn't gossip one
+	identity Identity
 }
 
 func NewGossipValue(t time.Time, v int64) GossipValue {
@@ -28,18 +31,28 @@ func NewGossipValue(t time.Time, v int64) GossipValue {
 	}
 }
 
-// Serialized gossip value into the following format 'time,value' where
+// WithIdentity returns a copy of [v] belonging to the node with [identity].
+func (v GossipValue) WithIdentity(identity Identity) GossipValue {
+	v.identity = identity
+	return v
+}
+
+// Serialized gossip value into the following format 'time,value' or 'time,value,identity' where
 // 	value is a string representing the int64 of value
 // 	time is a string representing number of seconds after 1970
+// 	identity is the UUID of the node the value belongs to, left out if empty
 func (v GossipValue) Serialize() string {
-	return fmt.Sprintf("%s%s%s", v.GetTimeString(), gossipValDelimeter, v.GetValueString())
+	if v.identity == "" {
+		return fmt.Sprintf("%s%s%s", v.GetTimeString(), gossipValDelimeter, v.GetValueString())
+	}
+	return fmt.Sprintf("%s%s%s%s%s", v.GetTimeString(), gossipValDelimeter, v.GetValueString(), gossipValDelimeter, v.identity.Serialize())
 }
 
-// Deserializes a GossipValue string in the following format 'time,value'
+// Deserializes a GossipValue string in the following format 'time,value' or 'time,value,identity'
 // Returns error if format is incorrect
 func  DeserializeGossipValue(valueStr string) (GossipValue, error) {
 	gossipValStrList := strings.Split(valueStr, gossipValDelimeter)
-	if len(gossipValStrList) == 1 || len(gossipValStrList) > 2  {
+	if len(gossipValStrList) == 1 || len(gossipValStrList) > 3  {
 		return GossipValue{}, InvalidGossipValueFormat
 	}
 	timeStr := gossipValStrList[0]
@@ -53,7 +66,19 @@ func  DeserializeGossipValue(valueStr string) (GossipValue, error) {
 	if err != nil {
 		return GossipValue{}, InvalidGossipValueFormat
 	}
-	return NewGossipValue(time, valInt), nil
+	if len(gossipValStrList) == 2 {
+		return NewGossipValue(time, valInt), nil
+	}
+	identity, err := DeserializeIdentity(gossipValStrList[2])
+	if err != nil {
+		return GossipValue{}, InvalidGossipValueFormat
+	}
+	return NewGossipValue(time, valInt).WithIdentity(identity), nil
+}
+
+// Equal returns true if [v] and [other] have the same time, value and identity.
+func (v GossipValue) Equal(other GossipValue) bool {
+	return v.time.Equal(other.time) && v.value == other.value && v.identity == other.identity
 }
 
 func (v GossipValue) GetTime() time.Time {
@@ -68,6 +93,11 @@ func (v GossipValue) GetValue() int64 {
 	return v.value
 }
 
+// GetIdentity returns the identity of the node [v] belongs to, empty if unknown
+func (v GossipValue) GetIdentity() Identity {
+	return v.identity
+}
+
 func (v GossipValue) GetValueString() string {
 	return fmt.Sprint(v.value)
 }
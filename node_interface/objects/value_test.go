@@ -52,4 +52,22 @@ func TestDeserializeNodeIDReturnsInvalidGossipValueFormatForNoDelimeter(t *testi
 	_, err := DeserializeNodeID(invalidGossipValStr)
 
 	require.Error(t, err, InvalidGossipValueFormat)
-}
\ No newline at end of file
+}
+
+func TestSerializeGossipValueWithIdentity(t *testing.T) {
+	time, _ := stringTimeToTime("1664228446")
+	gossipVal := NewGossipValue(time, 4).WithIdentity("6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+
+	gossipValStr := gossipVal.Serialize()
+	deserialized, err := DeserializeGossipValue(gossipValStr)
+
+	require.Equal(t, "1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8", gossipValStr)
+	require.NoError(t, err)
+	require.True(t, gossipVal.Equal(deserialized))
+}
+
+func TestDeserializeGossipValueReturnsInvalidGossipValueFormatForInvalidIdentity(t *testing.T) {
+	_, err := DeserializeGossipValue("1664228446,4,not-a-uuid")
+
+	require.ErrorIs(t, err, InvalidGossipValueFormat)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	identityFileName = "identity"
+)
+
+// LoadOrCreateIdentity returns the identity stored in the data directory, generating and storing a new one on first use.
+// The identity outlives changes to the node's address, so a node restarted on a new port is still the same node.
+func (s *Store) LoadOrCreateIdentity() (objects.Identity, error) {
+	path := filepath.Join(s.dir, identityFileName)
+	contents, err := os.ReadFile(path)
+	if err == nil {
+		identity, err := objects.DeserializeIdentity(strings.TrimSpace(string(contents)))
+		if err != nil {
+			return "", fmt.Errorf("Invalid identity file '%s': %w", path, err)
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	identity, err := objects.NewIdentity()
+	if err != nil {
+		return "", err
+	}
+	if err := WriteFileAtomic(path, []byte(identity.Serialize() + "\n"), filePerm); err != nil {
+		return "", err
+	}
+	return identity, nil
+}
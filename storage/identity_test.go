@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadOrCreateIdentityIsStable(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	identity, err := store.LoadOrCreateIdentity()
+	require.NoError(t, err)
+
+	reopened, err := NewStore(dir)
+	require.NoError(t, err)
+	reloaded, err := reopened.LoadOrCreateIdentity()
+
+	require.NoError(t, err)
+	require.Equal(t, identity, reloaded)
+}
+
+func TestLoadOrCreateIdentityReturnsInvalidIdentity(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(store.Dir(), identityFileName), []byte("node-1\n"), filePerm))
+
+	_, err = store.LoadOrCreateIdentity()
+
+	require.ErrorIs(t, err, objects.InvalidIdentity)
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	dataDirPerm = 0755
+	filePerm = 0644
+)
+
+var (
+	InvalidSnapshot = errors.New("Invalid snapshot format.")
+)
+
+// Snapshot is the state of a node persisted to its data directory so it can rejoin the cluster after a restart.
+type Snapshot struct {
+	Database *objects.Database
+
+	Peers []objects.NodeID
+
+	Blacklist []objects.NodeID
+
+	TakenAt time.Time
+}
+
+// snapshotFile is the on disk format of a Snapshot. The database is kept in its serialized text format.
+type snapshotFile struct {
+	TakenAt time.Time `json:"taken_at"`
+
+	Database string `json:"database"`
+
+	Peers []string `json:"peers"`
+
+	Blacklist []string `json:"blacklist"`
+}
+
+// Store reads and writes node state in a data directory.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store keeping its files in [dir], creating [dir] if it doesn't exist.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, dataDirPerm); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// SaveSnapshot atomically replaces the stored snapshot with [snap].
+func (s *Store) SaveSnapshot(snap *Snapshot) error {
+	file := snapshotFile{
+		TakenAt: snap.TakenAt,
+		Database: snap.Database.Serialize(),
+		Peers: serializeNodeIDs(snap.Peers),
+		Blacklist: serializeNodeIDs(snap.Blacklist),
+	}
+	contents, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(s.dir, snapshotFileName), contents, filePerm)
+}
+
+// LoadSnapshot returns the stored snapshot and true, or false if no snapshot has been saved yet.
+func (s *Store) LoadSnapshot() (*Snapshot, bool, error) {
+	contents, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, false, fmt.Errorf("%w %s", InvalidSnapshot, err.Error())
+	}
+	db, err := objects.DeserializeDatabase(file.Database)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w %s", InvalidSnapshot, err.Error())
+	}
+	peers, err := deserializeNodeIDs(file.Peers)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w %s", InvalidSnapshot, err.Error())
+	}
+	blacklist, err := deserializeNodeIDs(file.Blacklist)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w %s", InvalidSnapshot, err.Error())
+	}
+	return &Snapshot{
+		Database: db,
+		Peers: peers,
+		Blacklist: blacklist,
+		TakenAt: file.TakenAt,
+	}, true, nil
+}
+
+// WriteFileAtomic writes [data] to [path] such that after a crash [path] contains either its old contents or [data], never a mix.
+// The data is written to a temporary file in the same directory, fsynced, renamed over [path] and the directory is fsynced.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "." + filepath.Base(path) + ".tmp-*")
+	if err != nil {
+		return err
+	}
+	// no-op once the rename succeeded
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func serializeNodeIDs(nodeIDs []objects.NodeID) []string {
+	nodeIDStrs := make([]string, len(nodeIDs))
+	for i, id := range nodeIDs {
+		nodeIDStrs[i] = id.Serialize()
+	}
+	return nodeIDStrs
+}
+
+func deserializeNodeIDs(nodeIDStrs []string) ([]objects.NodeID, error) {
+	nodeIDs := make([]objects.NodeID, len(nodeIDStrs))
+	for i, idStr := range nodeIDStrs {
+		id, err := objects.DeserializeNodeID(idStr)
+		if err != nil {
+			return nil, err
+		}
+		nodeIDs[i] = id
+	}
+	return nodeIDs, nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSnapshotReturnsFalseWithoutSnapshot(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, found, err := store.LoadSnapshot()
+
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestSaveAndLoadSnapshot(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "data"))
+	require.NoError(t, err)
+	db := objects.InitializeDatabase()
+	nodeID := objects.NewNodeID("127.0.0.1", "8080")
+	db.SetGossipValue(nodeID, objects.NewGossipValue(time.Unix(1664228446, 0), 4))
+	peer := objects.NewNodeID("127.0.0.1", "3000")
+	blacklisted := objects.NewNodeID("121.104.230.38", "3000")
+	takenAt := time.Unix(1664228500, 0).UTC()
+
+	err = store.SaveSnapshot(&Snapshot{
+		Database: db,
+		Peers: []objects.NodeID{peer},
+		Blacklist: []objects.NodeID{blacklisted},
+		TakenAt: takenAt,
+	})
+	require.NoError(t, err)
+	snap, found, err := store.LoadSnapshot()
+
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, db.Serialize(), snap.Database.Serialize())
+	require.Equal(t, []objects.NodeID{peer}, snap.Peers)
+	require.Equal(t, []objects.NodeID{blacklisted}, snap.Blacklist)
+	require.True(t, takenAt.Equal(snap.TakenAt))
+}
+
+func TestLoadSnapshotReturnsInvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFileName), []byte("{\"database\": \"garbage\\n\"}"), filePerm))
+
+	_, _, err = store.LoadSnapshot()
+
+	require.ErrorIs(t, err, InvalidSnapshot)
+}
+
+func TestWriteFileAtomicReplacesFileAndLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state")
+	require.NoError(t, os.WriteFile(path, []byte("old"), filePerm))
+
+	require.NoError(t, WriteFileAtomic(path, []byte("new"), filePerm))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(contents))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	walFileName = "wal.log"
+	// length of the hex encoded crc32 checksum prefixing every record
+	checksumLen = 8
+	recordDelimeter = ' '
+)
+
+var (
+	InvalidWALRecord = errors.New("Invalid write-ahead log record.")
+)
+
+// WALEntry is a single database entry recorded in the write-ahead log.
+type WALEntry struct {
+	NodeID objects.NodeID
+
+	Value objects.GossipValue
+}
+
+// WAL is an append-only log of database entries set since the last snapshot, so updates made between snapshots survive a crash.
+// Every record is written on its own line in the following format:
+//
+//	<crc32 of entry, 8 hex digits> <ip-address>:<port>,<timestamp>,<value>[,<identity>]
+//
+// ex. 'f5ec45ba 127.0.0.1:8080,1664228446,4' or '283db109 127.0.0.1:8080,1664228446,4,6ba7b810-9dad-41d1-80b4-00c04fd430c8'
+//
+// Replaying the log is idempotent since the database only keeps the entry with the latest timestamp for each NodeID, so records
+// already contained in a snapshot can safely be replayed on top of it.
+type WAL struct {
+	file *os.File
+
+	mutex sync.Mutex
+}
+
+// OpenWAL opens the write-ahead log in the store's data directory, creating it if it doesn't exist.
+func (s *Store) OpenWAL() (*WAL, error) {
+	file, err := os.OpenFile(filepath.Join(s.dir, walFileName), os.O_CREATE|os.O_RDWR|os.O_APPEND, filePerm)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{file: file}, nil
+}
+
+// Append durably records [entries] with a single fsync.
+func (w *WAL) Append(entries ...WALEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		buf.WriteString(encodeRecord(objects.SerializeDatabaseEntry(entry.NodeID, entry.Value)))
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Replay sets every entry in the log in [db], in the order they were appended, and returns the number of entries replayed.
+// A torn or corrupt record (ex. from a crash in the middle of a write) ends the replay: it and everything after it is truncated from
+// the log and reported with an error wrapping InvalidWALRecord, along with the number of entries replayed before it.
+func (w *WAL) Replay(db *objects.Database) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(w.file)
+	replayed := 0
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return replayed, nil
+		}
+		if err != nil && err != io.EOF {
+			return replayed, err
+		}
+		id, value, recordErr := decodeRecord(line)
+		if recordErr != nil {
+			if truncErr := w.file.Truncate(offset); truncErr != nil {
+				return replayed, truncErr
+			}
+			return replayed, fmt.Errorf("%w Truncated the log after %d entries: %s", InvalidWALRecord, replayed, recordErr.Error())
+		}
+		db.SetGossipValue(id, value)
+		replayed++
+		offset += int64(len(line))
+	}
+}
+
+// Compact calls [saveSnapshot] and, if it succeeds, empties the log since every entry in it is now part of the snapshot.
+// Appends block until the compaction finishes so no entry can be lost between the snapshot and the truncation.
+func (w *WAL) Compact(saveSnapshot func() error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := saveSnapshot(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.file.Close()
+}
+
+func encodeRecord(entryStr string) string {
+	return fmt.Sprintf("%08x%c%s\n", crc32.ChecksumIEEE([]byte(entryStr)), recordDelimeter, entryStr)
+}
+
+func decodeRecord(line string) (objects.NodeID, objects.GossipValue, error) {
+	if len(line) < checksumLen + 2 || line[len(line) - 1] != '\n' || line[checksumLen] != recordDelimeter {
+		return objects.NodeID{}, objects.GossipValue{}, InvalidWALRecord
+	}
+	checksum, err := strconv.ParseUint(line[:checksumLen], 16, 32)
+	if err != nil {
+		return objects.NodeID{}, objects.GossipValue{}, InvalidWALRecord
+	}
+	entryStr := line[checksumLen + 1:len(line) - 1]
+	if crc32.ChecksumIEEE([]byte(entryStr)) != uint32(checksum) {
+		return objects.NodeID{}, objects.GossipValue{}, InvalidWALRecord
+	}
+	return objects.DeserializeDatabaseEntry(entryStr)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"github.com/tedim52/gossip_two/node_interface/objects"
+
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openTestWAL(t *testing.T) (*Store, *WAL) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	wal, err := store.OpenWAL()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		wal.Close()
+	})
+	return store, wal
+}
+
+func TestReplayAppliesAppendedEntries(t *testing.T) {
+	_, wal := openTestWAL(t)
+	nodeIDOne := objects.NewNodeID("127.0.0.1", "8080")
+	nodeIDTwo := objects.NewNodeID("121.104.230.38", "3000")
+	require.NoError(t, wal.Append(WALEntry{NodeID: nodeIDOne, Value: objects.NewGossipValue(time.Unix(1664228446, 0), 4)}))
+	require.NoError(t, wal.Append(
+		WALEntry{NodeID: nodeIDOne, Value: objects.NewGossipValue(time.Unix(1664228450, 0), 5)},
+		WALEntry{NodeID: nodeIDTwo, Value: objects.NewGossipValue(time.Unix(1663218247, 0), 7)},
+	))
+	db := objects.InitializeDatabase()
+
+	replayed, err := wal.Replay(db)
+
+	require.NoError(t, err)
+	require.Equal(t, 3, replayed)
+	require.Equal(t, 2, db.Size())
+	gossipVal, _ := db.GetGossipValue(nodeIDOne)
+	require.Equal(t, int64(5), gossipVal.GetValue())
+}
+
+func TestReplayTruncatesCorruptTail(t *testing.T) {
+	store, wal := openTestWAL(t)
+	nodeID := objects.NewNodeID("127.0.0.1", "8080")
+	require.NoError(t, wal.Append(WALEntry{NodeID: nodeID, Value: objects.NewGossipValue(time.Unix(1664228446, 0), 4)}))
+	walPath := filepath.Join(store.Dir(), walFileName)
+	goodContents, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	// a checksum mismatch followed by a torn write
+	file, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, filePerm)
+	require.NoError(t, err)
+	_, err = file.WriteString("00000000 127.0.0.1:8080,1664228450,5\n3f2a")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	db := objects.InitializeDatabase()
+	replayed, err := wal.Replay(db)
+
+	require.ErrorIs(t, err, InvalidWALRecord)
+	require.Equal(t, 1, replayed)
+	gossipVal, _ := db.GetGossipValue(nodeID)
+	require.Equal(t, int64(4), gossipVal.GetValue())
+	contents, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	require.Equal(t, goodContents, contents)
+}
+
+func TestCompactEmptiesLogAfterSnapshot(t *testing.T) {
+	_, wal := openTestWAL(t)
+	nodeID := objects.NewNodeID("127.0.0.1", "8080")
+	require.NoError(t, wal.Append(WALEntry{NodeID: nodeID, Value: objects.NewGossipValue(time.Unix(1664228446, 0), 4)}))
+	snapshotSaved := false
+
+	err := wal.Compact(func() error {
+		snapshotSaved = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, wal.Append(WALEntry{NodeID: nodeID, Value: objects.NewGossipValue(time.Unix(1664228450, 0), 5)}))
+	db := objects.InitializeDatabase()
+	replayed, err := wal.Replay(db)
+
+	require.True(t, snapshotSaved)
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+}
+
+func TestCompactKeepsLogIfSnapshotFails(t *testing.T) {
+	_, wal := openTestWAL(t)
+	nodeID := objects.NewNodeID("127.0.0.1", "8080")
+	require.NoError(t, wal.Append(WALEntry{NodeID: nodeID, Value: objects.NewGossipValue(time.Unix(1664228446, 0), 4)}))
+
+	err := wal.Compact(func() error {
+		return os.ErrPermission
+	})
+	db := objects.InitializeDatabase()
+	replayed, replayErr := wal.Replay(db)
+
+	require.ErrorIs(t, err, os.ErrPermission)
+	require.NoError(t, replayErr)
+	require.Equal(t, 1, replayed)
+}